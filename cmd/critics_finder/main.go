@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/MamfTheKramf/critics_finder/internal/dataset"
 	"github.com/MamfTheKramf/critics_finder/internal/fetch"
+	"github.com/MamfTheKramf/critics_finder/internal/migrate"
 	"github.com/MamfTheKramf/critics_finder/internal/normalize"
 	"github.com/MamfTheKramf/critics_finder/internal/tui"
 )
@@ -15,6 +17,9 @@ func main() {
 	argMap["tui"] = tui.StartTui
 	argMap["fetch"] = fetch.FetchMain
 	argMap["normalize"] = normalize.NormalizeMain
+	argMap["migrate"] = migrate.MigrateMain
+	argMap["export"] = dataset.ExportMain
+	argMap["import"] = dataset.ImportMain
 
 	if len(os.Args) < 2 {
 		fmt.Fprintln(os.Stderr, "Expect arguments")
@@ -0,0 +1,407 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Returns nil for unknown values, so they are exported as empty cells or null
+func unknownIf[V comparable](value, unknown V) any {
+	if value == unknown {
+		return nil
+	}
+	return value
+}
+
+func formatDate(date time.Time) any {
+	if date.IsZero() {
+		return nil
+	}
+	return date.Format(DATE_FORMAT)
+}
+
+// Parses an integer. Empty cells are the unknown value
+func parseInt(cell string, unknown int) (int, error) {
+	if cell == "" {
+		return unknown, nil
+	}
+	return strconv.Atoi(cell)
+}
+
+// Parses a boolean. Empty cells are false
+func parseBool(cell string) (bool, error) {
+	if cell == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(cell)
+}
+
+func parseScore(cell string) (float32, error) {
+	score, err := strconv.ParseFloat(cell, 32)
+	return float32(score), err
+}
+
+// Parses a JSON array of strings. Empty cells are an empty list
+func parseList(cell string) ([]string, error) {
+	if cell == "" {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(cell), &list); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of strings: %w", err)
+	}
+	return list, nil
+}
+
+// Parses a date in DATE_FORMAT. Dates without a time (YYYY-MM-DD) are accepted too, since they are easier to write by hand
+func parseDate(cell string) (time.Time, error) {
+	if cell == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(DATE_FORMAT, cell)
+	if err != nil {
+		if day, dayErr := time.Parse(time.DateOnly, cell); dayErr == nil {
+			return day, nil
+		}
+	}
+	return date, err
+}
+
+// Parses 'movie' or 'tv'. Empty cells are movies, like in data written before TV reviews were fetched
+func parseMediaType(cell string) (utils.MediaType, error) {
+	switch mediaType := utils.MediaType(cell).OrDefault(); mediaType {
+	case utils.MediaTypeMovie, utils.MediaTypeTv:
+		return mediaType, nil
+	}
+	return "", fmt.Errorf("expected '%s' or '%s'", utils.MediaTypeMovie, utils.MediaTypeTv)
+}
+
+func parseSentiment(cell string) (utils.Sentiment, error) {
+	switch sentiment := utils.Sentiment(cell); sentiment {
+	case "", utils.SentimentFresh, utils.SentimentRotten:
+		return sentiment, nil
+	}
+	return "", fmt.Errorf("expected '%s', '%s' or nothing", utils.SentimentFresh, utils.SentimentRotten)
+}
+
+// Returns the value of a metadata column. It's nil if the metadata of the medium wasn't fetched
+func metadata(get func(m *utils.Media) any) func(r *record[utils.Media]) any {
+	return func(r *record[utils.Media]) any {
+		if !r.value.MetadataFetched {
+			return nil
+		}
+		return get(&r.value)
+	}
+}
+
+// Sets a metadata column. Any non-empty metadata cell marks the metadata as fetched
+func setMetadata(set func(m *utils.Media, cell string) error) func(r *record[utils.Media], cell string) error {
+	return func(r *record[utils.Media], cell string) error {
+		if cell == "" {
+			return nil
+		}
+		r.value.MetadataFetched = true
+		return set(&r.value, cell)
+	}
+}
+
+var criticsDataset = &dataset[utils.Critic]{
+	name:        "critics",
+	description: "The critics (written by 'fetch critics', 'fetch profiles' and 'fetch discover')",
+	defaultPath: utils.DefaultCriticsFile,
+	columns: []column[utils.Critic]{
+		{
+			name: "name", desc: "Name of the critic",
+			get: func(r *record[utils.Critic]) any { return r.value.Name },
+			set: func(r *record[utils.Critic], cell string) error { r.value.Name = cell; return nil },
+		},
+		{
+			name: "url", desc: "URL of the critic (the part after /critics/), also used as the critic column of the other datasets", required: true,
+			get: func(r *record[utils.Critic]) any { return r.value.Url },
+			set: func(r *record[utils.Critic], cell string) error { r.value.Url = cell; return checkCriticUrl(cell) },
+		},
+		{
+			name: "publications", desc: "Publications the critic writes for (from the profile)",
+			get: func(r *record[utils.Critic]) any { return r.value.Publications },
+			set: func(r *record[utils.Critic], cell string) (err error) {
+				r.value.Publications, err = parseList(cell)
+				return
+			},
+		},
+		{
+			name: "top_critic", desc: "Whether the critic is a Top Critic (from the profile)",
+			get: func(r *record[utils.Critic]) any { return r.value.TopCritic },
+			set: func(r *record[utils.Critic], cell string) (err error) {
+				r.value.TopCritic, err = parseBool(cell)
+				return
+			},
+		},
+		{
+			name: "tomatometer_approved", desc: "Whether the critic is Tomatometer-approved (from the profile)",
+			get: func(r *record[utils.Critic]) any { return r.value.TomatometerApproved },
+			set: func(r *record[utils.Critic], cell string) (err error) {
+				r.value.TomatometerApproved, err = parseBool(cell)
+				return
+			},
+		},
+		{
+			name: "review_count", desc: "Total number of reviews according to the profile (empty if unknown)",
+			get: func(r *record[utils.Critic]) any { return unknownIf(r.value.ReviewCount, 0) },
+			set: func(r *record[utils.Critic], cell string) (err error) {
+				r.value.ReviewCount, err = parseInt(cell, 0)
+				return
+			},
+		},
+	},
+	key: func(r *record[utils.Critic]) string { return r.value.Url },
+}
+
+var reviewsDataset = &dataset[utils.Review]{
+	name:        "reviews",
+	description: "The raw reviews of all critics (written by 'fetch all-reviews')",
+	defaultPath: utils.DefaultReviewsDir,
+	perCritic:   true,
+	columns: []column[utils.Review]{
+		criticColumn[utils.Review](),
+		{
+			name: "score", desc: "Score as given by the critic, e.g. '3.5/5' or 'B+' (empty if there is none)",
+			get: func(r *record[utils.Review]) any { return r.value.Score },
+			set: func(r *record[utils.Review], cell string) error { r.value.Score = cell; return nil },
+		},
+		{
+			name: "media_title", desc: "Title of the medium",
+			get: func(r *record[utils.Review]) any { return r.value.MediaTitle },
+			set: func(r *record[utils.Review], cell string) error { r.value.MediaTitle = cell; return nil },
+		},
+		{
+			name: "media_info", desc: "Additional info about the medium, e.g. the year",
+			get: func(r *record[utils.Review]) any { return r.value.MediaInfo },
+			set: func(r *record[utils.Review], cell string) error { r.value.MediaInfo = cell; return nil },
+		},
+		{
+			name: "media_url", desc: "URL of the medium, e.g. '/m/some_movie'", required: true,
+			get: func(r *record[utils.Review]) any { return r.value.MediaUrl },
+			set: func(r *record[utils.Review], cell string) error { r.value.MediaUrl = cell; return nil },
+		},
+		{
+			name: "media_type", desc: "'movie' or 'tv'",
+			get: func(r *record[utils.Review]) any { return string(r.value.MediaType.OrDefault()) },
+			set: func(r *record[utils.Review], cell string) (err error) {
+				r.value.MediaType, err = parseMediaType(cell)
+				return
+			},
+		},
+		{
+			name: "date", desc: "Date the review was published (empty if unknown)",
+			get: func(r *record[utils.Review]) any { return formatDate(r.value.Date) },
+			set: func(r *record[utils.Review], cell string) (err error) {
+				r.value.Date, err = parseDate(cell)
+				return
+			},
+		},
+		{
+			name: "publication", desc: "Publication the review appeared in",
+			get: func(r *record[utils.Review]) any { return r.value.Publication },
+			set: func(r *record[utils.Review], cell string) error { r.value.Publication = cell; return nil },
+		},
+		{
+			name: "sentiment", desc: "'fresh' or 'rotten' (empty if unknown)",
+			get: func(r *record[utils.Review]) any { return unknownIf(string(r.value.Sentiment), "") },
+			set: func(r *record[utils.Review], cell string) (err error) {
+				r.value.Sentiment, err = parseSentiment(cell)
+				return
+			},
+		},
+		{
+			name: "quote", desc: "Short excerpt of the review",
+			get: func(r *record[utils.Review]) any { return r.value.Quote },
+			set: func(r *record[utils.Review], cell string) error { r.value.Quote = cell; return nil },
+		},
+		{
+			name: "review_url", desc: "Link to the full review",
+			get: func(r *record[utils.Review]) any { return r.value.ReviewUrl },
+			set: func(r *record[utils.Review], cell string) error { r.value.ReviewUrl = cell; return nil },
+		},
+	},
+	complete: func(r *record[utils.Review]) error {
+		r.value.MediaType = r.value.MediaType.OrDefault()
+		return nil
+	},
+	key: func(r *record[utils.Review]) string { return criticKey(r.critic, r.value.MediaUrl) },
+}
+
+var normalizedDataset = &dataset[utils.NumericReview]{
+	name:        "normalized",
+	description: "The normalized reviews of all critics (written by 'normalize')",
+	defaultPath: utils.DefaultNormalizedDir,
+	perCritic:   true,
+	columns: []column[utils.NumericReview]{
+		criticColumn[utils.NumericReview](),
+		{
+			name: "score", desc: "Normalized score from 0 to 1", required: true,
+			get: func(r *record[utils.NumericReview]) any { return r.value.Score },
+			set: func(r *record[utils.NumericReview], cell string) (err error) {
+				r.value.Score, err = parseScore(cell)
+				return
+			},
+		},
+		{
+			name: "media_url", desc: "URL of the medium", required: true,
+			get: func(r *record[utils.NumericReview]) any { return r.value.MediaUrl },
+			set: func(r *record[utils.NumericReview], cell string) error { r.value.MediaUrl = cell; return nil },
+		},
+		mediaTypeColumn(),
+	},
+	complete: completeNumericReview,
+	key:      func(r *record[utils.NumericReview]) string { return criticKey(r.critic, r.value.MediaUrl) },
+}
+
+var mediaDataset = &dataset[utils.Media]{
+	name:        "media",
+	description: "All reviewed media (written by 'normalize', metadata added by 'fetch media')",
+	defaultPath: utils.DefaultMediaFile,
+	columns: []column[utils.Media]{
+		{
+			name: "media_title", desc: "Title of the medium",
+			get: func(r *record[utils.Media]) any { return r.value.MediaTitle },
+			set: func(r *record[utils.Media], cell string) error { r.value.MediaTitle = cell; return nil },
+		},
+		{
+			name: "media_info", desc: "Additional info about the medium, e.g. the year",
+			get: func(r *record[utils.Media]) any { return r.value.MediaInfo },
+			set: func(r *record[utils.Media], cell string) error { r.value.MediaInfo = cell; return nil },
+		},
+		{
+			name: "media_url", desc: "URL of the medium", required: true,
+			get: func(r *record[utils.Media]) any { return r.value.MediaUrl },
+			set: func(r *record[utils.Media], cell string) error { r.value.MediaUrl = cell; return nil },
+		},
+		{
+			name: "media_type", desc: "'movie' or 'tv'",
+			get: func(r *record[utils.Media]) any { return string(r.value.MediaType.OrDefault()) },
+			set: func(r *record[utils.Media], cell string) (err error) {
+				r.value.MediaType, err = parseMediaType(cell)
+				return
+			},
+		},
+		{
+			name: "release_year", desc: "Year of the release (empty if unknown)",
+			get: metadata(func(m *utils.Media) any { return unknownIf(m.ReleaseYear, 0) }),
+			set: setMetadata(func(m *utils.Media, cell string) (err error) {
+				m.ReleaseYear, err = parseInt(cell, 0)
+				return
+			}),
+		},
+		{
+			name: "genres", desc: "Genres of the medium",
+			get: metadata(func(m *utils.Media) any { return m.Genres }),
+			set: setMetadata(func(m *utils.Media, cell string) (err error) {
+				m.Genres, err = parseList(cell)
+				return
+			}),
+		},
+		{
+			name: "runtime_minutes", desc: "Runtime in minutes (empty if unknown)",
+			get: metadata(func(m *utils.Media) any { return unknownIf(m.RuntimeMinutes, 0) }),
+			set: setMetadata(func(m *utils.Media, cell string) (err error) {
+				m.RuntimeMinutes, err = parseInt(cell, 0)
+				return
+			}),
+		},
+		{
+			name: "rating", desc: "Content rating, e.g. 'PG-13' (empty if unknown)",
+			get: metadata(func(m *utils.Media) any { return unknownIf(m.Rating, "") }),
+			set: setMetadata(func(m *utils.Media, cell string) error { m.Rating = cell; return nil }),
+		},
+		{
+			name: "tomatometer_score", desc: "Tomatometer from 0 to 100 (empty if unknown)",
+			get: metadata(func(m *utils.Media) any { return unknownIf(m.TomatometerScore, -1) }),
+			set: setMetadata(func(m *utils.Media, cell string) (err error) {
+				m.TomatometerScore, err = parseInt(cell, -1)
+				return
+			}),
+		},
+		{
+			name: "audience_score", desc: "Audience score from 0 to 100 (empty if unknown)",
+			get: metadata(func(m *utils.Media) any { return unknownIf(m.AudienceScore, -1) }),
+			set: setMetadata(func(m *utils.Media, cell string) (err error) {
+				m.AudienceScore, err = parseInt(cell, -1)
+				return
+			}),
+		},
+	},
+	init: func(m *utils.Media) {
+		// scores that aren't given are unknown rather than 0%
+		m.TomatometerScore = -1
+		m.AudienceScore = -1
+	},
+	complete: func(r *record[utils.Media]) error {
+		r.value.MediaType = r.value.MediaType.OrDefault()
+		if !r.value.MetadataFetched {
+			r.value.MediaMetadata = utils.MediaMetadata{}
+		}
+		return nil
+	},
+	key: func(r *record[utils.Media]) string { return r.value.MediaUrl },
+}
+
+var userRatingsDataset = &dataset[utils.NumericReview]{
+	name:        "user-ratings",
+	description: "Your own ratings (written by 'tui')",
+	defaultPath: utils.DefaultUserRatingsFile,
+	columns: []column[utils.NumericReview]{
+		{
+			name: "score", desc: "Your score from 0 to 1", required: true,
+			get: func(r *record[utils.NumericReview]) any { return r.value.Score },
+			set: func(r *record[utils.NumericReview], cell string) (err error) {
+				r.value.Score, err = parseScore(cell)
+				return
+			},
+		},
+		{
+			name: "media_url", desc: "URL of the medium", required: true,
+			get: func(r *record[utils.NumericReview]) any { return r.value.MediaUrl },
+			set: func(r *record[utils.NumericReview], cell string) error { r.value.MediaUrl = cell; return nil },
+		},
+		mediaTypeColumn(),
+	},
+	complete: completeNumericReview,
+	key:      func(r *record[utils.NumericReview]) string { return r.value.MediaUrl },
+}
+
+// Key of a record that is unique per critic. Critic URLs can't contain a '/', so the key is unambiguous
+func criticKey(critic, mediaUrl string) string {
+	return critic + "/" + mediaUrl
+}
+
+// The column with the URL of the critic the record belongs to. It decides which file the record is imported into
+func criticColumn[T fmt.Stringer]() column[T] {
+	return column[T]{
+		name: "critic", desc: "URL of the critic who wrote the review", required: true,
+		get: func(r *record[T]) any { return r.critic },
+		set: func(r *record[T], cell string) error { r.critic = cell; return checkCriticUrl(cell) },
+	}
+}
+
+func mediaTypeColumn() column[utils.NumericReview] {
+	return column[utils.NumericReview]{
+		name: "media_type", desc: "'movie' or 'tv'",
+		get: func(r *record[utils.NumericReview]) any { return string(r.value.MediaType.OrDefault()) },
+		set: func(r *record[utils.NumericReview], cell string) (err error) {
+			r.value.MediaType, err = parseMediaType(cell)
+			return
+		},
+	}
+}
+
+func completeNumericReview(r *record[utils.NumericReview]) error {
+	r.value.MediaType = r.value.MediaType.OrDefault()
+	if r.value.Score < 0 || r.value.Score > 1 {
+		return fmt.Errorf("score %v isn't between 0 and 1", r.value.Score)
+	}
+	return nil
+}
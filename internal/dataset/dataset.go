@@ -0,0 +1,352 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Format of the dates in exported and imported files. It keeps the time and zone, so dates survive an export and import unchanged
+const DATE_FORMAT = time.RFC3339
+
+// A record of type T together with the URL of the critic it belongs to (empty for datasets that aren't split per critic)
+type record[T any] struct {
+	critic string
+	value  T
+}
+
+// A column of an exported or imported dataset
+type column[T any] struct {
+	name string
+	desc string
+	// Rows without a value for it can't be imported
+	required bool
+	// Returns the value of the column: a string, bool, int, float32, []string or nil if the value is unknown
+	get func(r *record[T]) any
+	// Sets the value of the column from a CSV cell (or the corresponding JSON value, see rowReader)
+	set func(r *record[T], cell string) error
+}
+
+// One of the kinds of data critics_finder stores
+type Dataset interface {
+	Name() string
+	Description() string
+	// File or directory the data is read from by default
+	DefaultPath() string
+	// Names of all columns
+	Columns() []string
+	// Description of each column (in the order of Columns)
+	ColumnDescriptions() []string
+	// Writes the given columns of all records stored in the file or directory at src to w. Returns the number of written records
+	export(src string, columns []string, w rowWriter) (int, error)
+	// Validates all rows and writes them to the file or directory at out. See Import
+	importRows(rows rowReader, out string, skipBadRows bool) (ImportResult, error)
+}
+
+type dataset[T fmt.Stringer] struct {
+	name        string
+	description string
+	defaultPath string
+	// The data is stored in one file per critic inside a directory, named after the critic's URL
+	perCritic bool
+	columns   []column[T]
+	// Sets the defaults of an imported record before its columns are set (optional)
+	init func(value *T)
+	// Validates and fixes up an imported record after all of its columns were set (optional)
+	complete func(r *record[T]) error
+	// Returns what identifies a record. The other commands expect it to be unique, so imported rows with a key seen before are bad
+	key func(r *record[T]) string
+}
+
+func (d *dataset[T]) Name() string        { return d.name }
+func (d *dataset[T]) Description() string { return d.description }
+func (d *dataset[T]) DefaultPath() string { return d.defaultPath }
+
+func (d *dataset[T]) Columns() []string {
+	var names []string
+	for _, col := range d.columns {
+		names = append(names, col.name)
+	}
+	return names
+}
+
+func (d *dataset[T]) ColumnDescriptions() []string {
+	var descriptions []string
+	for _, col := range d.columns {
+		descriptions = append(descriptions, col.desc)
+	}
+	return descriptions
+}
+
+// Returns the columns with the given names (all of them if names is empty)
+func (d *dataset[T]) selectColumns(names []string) ([]column[T], error) {
+	if len(names) == 0 {
+		return d.columns, nil
+	}
+	var selected []column[T]
+	for _, name := range names {
+		idx := -1
+		for i, col := range d.columns {
+			if col.name == name {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown column '%s' of %s. Expected one of %s", name, d.name, strings.Join(d.Columns(), ", "))
+		}
+		selected = append(selected, d.columns[idx])
+	}
+	return selected, nil
+}
+
+// Returns the files the records are stored in (sorted by name) together with the critic each of them belongs to
+func (d *dataset[T]) files(src string) ([]string, []string, error) {
+	if !d.perCritic {
+		return []string{src}, []string{""}, nil
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files, critics []string
+	for _, entry := range entries {
+		// the reviews directory also contains the journal and failure report of the fetch command
+		if entry.IsDir() || path.Ext(entry.Name()) != ".gob" {
+			continue
+		}
+		files = append(files, path.Join(src, entry.Name()))
+		critics = append(critics, strings.TrimSuffix(entry.Name(), ".gob"))
+	}
+	return files, critics, nil
+}
+
+// Returns the column with the given name
+func (d *dataset[T]) column(name string) (*column[T], bool) {
+	for idx := range d.columns {
+		if d.columns[idx].name == name {
+			return &d.columns[idx], true
+		}
+	}
+	return nil, false
+}
+
+func (d *dataset[T]) export(src string, names []string, w rowWriter) (int, error) {
+	columns, err := d.selectColumns(names)
+	if err != nil {
+		return 0, err
+	}
+	files, critics, err := d.files(src)
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]string, len(columns))
+	for idx, col := range columns {
+		header[idx] = col.name
+	}
+	if err := w.writeHeader(header); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	values := make([]any, len(columns))
+	for idx, file := range files {
+		// records are streamed, so the size of the dataset doesn't matter
+		err := utils.EachStruct(file, func(value T) error {
+			r := record[T]{critic: critics[idx], value: value}
+			for idx, col := range columns {
+				values[idx] = col.get(&r)
+			}
+			written++
+			return w.writeRow(values)
+		})
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, w.flush()
+}
+
+// All datasets in the order they are created
+var Datasets = []Dataset{criticsDataset, reviewsDataset, normalizedDataset, mediaDataset, userRatingsDataset}
+
+// Returns the dataset with the given name
+func Find(name string) (Dataset, error) {
+	var names []string
+	for _, d := range Datasets {
+		if d.Name() == name {
+			return d, nil
+		}
+		names = append(names, d.Name())
+	}
+	return nil, fmt.Errorf("unknown dataset '%s'. Expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Critic URLs are used as file names, so they mustn't point anywhere else
+func checkCriticUrl(url string) error {
+	if url == "." || url == ".." || strings.ContainsAny(url, "/\\") {
+		return fmt.Errorf("'%s' isn't a valid critic URL", url)
+	}
+	return nil
+}
+
+// A row that couldn't be imported
+type RowError struct {
+	// Line of the input file the row starts in
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Outcome of an import
+type ImportResult struct {
+	// Number of imported records
+	Imported int
+	// Files that were written
+	Files []string
+	// Rows that couldn't be imported
+	BadRows []*RowError
+}
+
+// Turns a row into a record. Returns all problems of the row at once
+func (d *dataset[T]) parseRow(cells map[string]string) (record[T], error) {
+	var r record[T]
+	if d.init != nil {
+		d.init(&r.value)
+	}
+
+	var problems []string
+	for _, col := range d.columns {
+		cell, prs := cells[col.name]
+		if col.required && cell == "" {
+			problems = append(problems, fmt.Sprintf("%s is missing", col.name))
+			continue
+		}
+		if !prs {
+			continue
+		}
+		if err := col.set(&r, cell); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", col.name, err))
+		}
+	}
+	for name := range cells {
+		if _, ok := d.column(name); !ok {
+			problems = append(problems, fmt.Sprintf("unknown column '%s'", name))
+		}
+	}
+	if len(problems) == 0 && d.complete != nil {
+		if err := d.complete(&r); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return r, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return r, nil
+}
+
+func (d *dataset[T]) importRows(rows rowReader, out string, skipBadRows bool) (ImportResult, error) {
+	var result ImportResult
+	// a column missing in the header would make every row bad
+	if header := rows.columns(); header != nil {
+		present := make(map[string]bool)
+		for _, name := range header {
+			if _, ok := d.column(name); !ok {
+				return result, fmt.Errorf("unknown column '%s' of %s. Expected some of %s", name, d.name, strings.Join(d.Columns(), ", "))
+			}
+			present[name] = true
+		}
+		for _, col := range d.columns {
+			if col.required && !present[col.name] {
+				return result, fmt.Errorf("required column '%s' of %s is missing", col.name, d.name)
+			}
+		}
+	}
+
+	// all rows are validated before anything is written
+	var critics []string
+	values := make(map[string][]T)
+	// line of the first row with each key
+	keys := make(map[string]int)
+	for {
+		cells, line, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			result.BadRows = append(result.BadRows, rowErr)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		r, err := d.parseRow(cells)
+		if err != nil {
+			result.BadRows = append(result.BadRows, &RowError{Line: line, Err: err})
+			continue
+		}
+		key := d.key(&r)
+		if first, prs := keys[key]; prs {
+			result.BadRows = append(result.BadRows, &RowError{Line: line, Err: fmt.Errorf("duplicate of line %d", first)})
+			continue
+		}
+		keys[key] = line
+		if _, prs := values[r.critic]; !prs {
+			critics = append(critics, r.critic)
+		}
+		values[r.critic] = append(values[r.critic], r.value)
+	}
+
+	if len(result.BadRows) > 0 && !skipBadRows {
+		return result, fmt.Errorf("%d rows can't be imported, nothing was written", len(result.BadRows))
+	}
+
+	if !d.perCritic {
+		if err := os.MkdirAll(path.Dir(out), os.ModePerm); err != nil {
+			return result, err
+		}
+		// also write an empty dataset, so the file exists afterwards
+		written, err := utils.WriteStructs(context.Background(), values[""], out, false)
+		if err != nil {
+			return result, err
+		}
+		result.Imported = written
+		result.Files = []string{out}
+		return result, nil
+	}
+
+	if err := os.MkdirAll(out, os.ModePerm); err != nil {
+		return result, err
+	}
+	// only the files of the critics in the input are replaced
+	for _, critic := range critics {
+		file := path.Join(out, critic+".gob")
+		written, err := utils.WriteStructs(context.Background(), values[critic], file, false)
+		if err != nil {
+			return result, err
+		}
+		result.Imported += written
+		result.Files = append(result.Files, file)
+	}
+	return result, nil
+}
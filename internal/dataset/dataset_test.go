@@ -0,0 +1,244 @@
+package dataset
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+func writeReviews(t *testing.T, dir string) {
+	os.MkdirAll(dir, os.ModePerm)
+	utils.WriteStructs(context.Background(), []utils.Review{
+		{Score: "3,5/5", MediaTitle: "Some \"Movie\"", MediaInfo: "2001", MediaUrl: "/m/some_movie", MediaType: utils.MediaTypeMovie,
+			Date: time.Date(2023, 9, 14, 18, 30, 0, 0, time.FixedZone("", 2*60*60)), Sentiment: utils.SentimentFresh, Quote: "Line one\nline two"},
+	}, path.Join(dir, "bob.gob"), false)
+	utils.WriteStructs(context.Background(), []utils.Review{
+		{Score: "B+", MediaTitle: "Some Show", MediaUrl: "/tv/some_show", MediaType: utils.MediaTypeTv},
+	}, path.Join(dir, "alice.gob"), false)
+	// the fetch command keeps its journal next to the reviews
+	os.WriteFile(path.Join(dir, "journal.jsonl"), []byte("{}\n"), 0644)
+}
+
+func TestExportCsv(t *testing.T) {
+	dir := t.TempDir()
+	writeReviews(t, path.Join(dir, "reviews"))
+	out := path.Join(dir, "reviews.csv")
+
+	written, err := Export(reviewsDataset, path.Join(dir, "reviews"), out, FORMAT_CSV, []string{"critic", "score", "media_title", "date", "sentiment", "quote"})
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if written != 2 {
+		t.Errorf("Expected 2 exported reviews. Got %d", written)
+	}
+
+	// exported files are meant to be shared
+	if info, _ := os.Stat(out); info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644. Got %v", info.Mode().Perm())
+	}
+
+	content, _ := os.ReadFile(out)
+	expected := "critic,score,media_title,date,sentiment,quote\r\n" +
+		"alice,B+,Some Show,,,\r\n" +
+		"bob,\"3,5/5\",\"Some \"\"Movie\"\"\",2023-09-14T18:30:00+02:00,fresh,\"Line one\r\nline two\"\r\n"
+	if string(content) != expected {
+		t.Errorf("Expected\n%q\nGot\n%q", expected, string(content))
+	}
+}
+
+func TestExportJsonl(t *testing.T) {
+	dir := t.TempDir()
+	mediaFile := path.Join(dir, "movies.gob")
+	utils.WriteStructs(context.Background(), []utils.Media{
+		{MediaTitle: "Some Movie", MediaUrl: "/m/some_movie", MediaMetadata: utils.MediaMetadata{
+			MetadataFetched: true, ReleaseYear: 2001, Genres: []string{"Drama", "Comedy"}, TomatometerScore: 87, AudienceScore: -1,
+		}},
+		{MediaTitle: "Other Movie", MediaUrl: "/m/other_movie"},
+	}, mediaFile, false)
+	out := path.Join(dir, "media.jsonl")
+
+	if _, err := Export(mediaDataset, mediaFile, out, formatOf(out), []string{"media_url", "media_type", "release_year", "genres", "tomatometer_score", "audience_score"}); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	content, _ := os.ReadFile(out)
+	expected := `{"media_url":"/m/some_movie","media_type":"movie","release_year":2001,"genres":["Drama","Comedy"],"tomatometer_score":87,"audience_score":null}` + "\n" +
+		`{"media_url":"/m/other_movie","media_type":"movie","release_year":null,"genres":null,"tomatometer_score":null,"audience_score":null}` + "\n"
+	if string(content) != expected {
+		t.Errorf("Expected\n%s\nGot\n%s", expected, string(content))
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeReviews(t, path.Join(dir, "reviews"))
+	out := path.Join(dir, "reviews.csv")
+
+	if _, err := Export(reviewsDataset, path.Join(dir, "reviews"), out, FORMAT_CSV, []string{"critic", "nope"}); err == nil {
+		t.Errorf("Expected an error for an unknown column")
+	}
+
+	// a corrupt file fails the export without leaving a partial file behind
+	os.WriteFile(path.Join(dir, "reviews", "carol.gob"), []byte("\x00CFDS garbage"), 0644)
+	if _, err := Export(reviewsDataset, path.Join(dir, "reviews"), out, FORMAT_CSV, nil); !utils.IsCorrupt(err) {
+		t.Errorf("Expected a corrupt file error. Got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected no output file. Got %v", entries)
+	}
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writeReviews(t, path.Join(dir, "reviews"))
+
+	for _, format := range []string{FORMAT_CSV, FORMAT_JSONL} {
+		exported := path.Join(dir, "reviews."+format)
+		if _, err := Export(reviewsDataset, path.Join(dir, "reviews"), exported, format, nil); err != nil {
+			t.Fatalf("Expected no error. Got %v", err)
+		}
+		out := path.Join(dir, "imported_"+format)
+		result, err := Import(reviewsDataset, exported, out, format, false)
+		if err != nil {
+			t.Fatalf("Expected no error. Got %v", err)
+		}
+		if result.Imported != 2 || len(result.Files) != 2 {
+			t.Errorf("Expected 2 reviews in 2 files. Got %+v", result)
+		}
+
+		for _, critic := range []string{"alice", "bob"} {
+			expected, _ := utils.ReadStructs[utils.Review](path.Join(dir, "reviews", critic+".gob"), false)
+			actual, err := utils.ReadStructs[utils.Review](path.Join(out, critic+".gob"), false)
+			if err != nil {
+				t.Fatalf("Expected no error. Got %v", err)
+			}
+			if len(actual) != 1 {
+				t.Fatalf("%s: Expected 1 review. Got %+v", format, actual)
+			}
+			// the time and zone of the date are kept
+			_, expectedOffset := expected[0].Date.Zone()
+			_, actualOffset := actual[0].Date.Zone()
+			if !actual[0].Date.Equal(expected[0].Date) || actualOffset != expectedOffset {
+				t.Errorf("%s: Expected date %v. Got %v", format, expected[0].Date, actual[0].Date)
+			}
+			actual[0].Date, expected[0].Date = time.Time{}, time.Time{}
+			if actual[0] != expected[0] {
+				t.Errorf("%s: Expected %+v. Got %+v", format, expected, actual)
+			}
+		}
+	}
+}
+
+func TestImportBadRows(t *testing.T) {
+	dir := t.TempDir()
+	src := path.Join(dir, "ratings.jsonl")
+	os.WriteFile(src, []byte(
+		`{"score":0.5,"media_url":"/m/some_movie"}`+"\n"+
+			"\n"+
+			`{"score":1.5,"media_url":"/m/other_movie"}`+"\n"+
+			`{"score":"","media_url":"/m/other_movie","nope":1}`+"\n"+
+			`{"score":0.5`+"\n"), 0644)
+	out := path.Join(dir, "user_ratings.gob")
+
+	result, err := Import(userRatingsDataset, src, out, FORMAT_JSONL, false)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	lines := []int{}
+	for _, rowErr := range result.BadRows {
+		lines = append(lines, rowErr.Line)
+	}
+	if len(lines) != 3 || lines[0] != 3 || lines[1] != 4 || lines[2] != 5 {
+		t.Errorf("Expected lines 3, 4 and 5 to be bad. Got %v", result.BadRows)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written")
+	}
+
+	result, err = Import(userRatingsDataset, src, out, FORMAT_JSONL, true)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	ratings, _ := utils.ReadStructs[utils.NumericReview](out, false)
+	if result.Imported != 1 || len(ratings) != 1 || ratings[0].Score != 0.5 || ratings[0].MediaType != utils.MediaTypeMovie {
+		t.Errorf("Expected the first rating to be imported. Got %+v", ratings)
+	}
+}
+
+func TestImportCsvErrors(t *testing.T) {
+	dir := t.TempDir()
+	out := path.Join(dir, "reviews")
+
+	for _, content := range []string{"", "critic,media_url,critic\n", "critic,media_title\nbob,Some Movie\n", "critic,nope,media_url\n"} {
+		src := path.Join(dir, "reviews.csv")
+		os.WriteFile(src, []byte(content), 0644)
+		if _, err := Import(reviewsDataset, src, out, FORMAT_CSV, true); err == nil {
+			t.Errorf("Expected an error for %q", content)
+		}
+	}
+
+	// a critic URL can't escape the reviews directory
+	src := path.Join(dir, "reviews.csv")
+	os.WriteFile(src, []byte("critic,media_url\n../bob,/m/some_movie\nbob,/m/some_movie,extra\n"), 0644)
+	result, _ := Import(reviewsDataset, src, out, FORMAT_CSV, false)
+	if len(result.BadRows) != 2 || result.BadRows[0].Line != 2 || result.BadRows[1].Line != 3 {
+		t.Errorf("Expected lines 2 and 3 to be bad. Got %v", result.BadRows)
+	}
+}
+
+func TestImportOnlyReplacesListedCritics(t *testing.T) {
+	dir := t.TempDir()
+	reviewsDir := path.Join(dir, "reviews")
+	writeReviews(t, reviewsDir)
+	src := path.Join(dir, "bob.csv")
+	os.WriteFile(src, []byte("\ufeffcritic,score,media_url\nbob,4/5,/m/fixed\nbob,,/m/other\n"), 0644)
+
+	result, err := Import(reviewsDataset, src, reviewsDir, FORMAT_CSV, false)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0] != path.Join(reviewsDir, "bob.gob") {
+		t.Errorf("Expected only bob's file to be written. Got %v", result.Files)
+	}
+
+	bob, _ := utils.ReadStructs[utils.Review](path.Join(reviewsDir, "bob.gob"), false)
+	if len(bob) != 2 || bob[0].Score != "4/5" || bob[1].MediaUrl != "/m/other" {
+		t.Errorf("Expected bob's reviews to be replaced. Got %+v", bob)
+	}
+	alice, _ := utils.ReadStructs[utils.Review](path.Join(reviewsDir, "alice.gob"), false)
+	if len(alice) != 1 || alice[0].Score != "B+" {
+		t.Errorf("Expected alice's reviews to be kept. Got %+v", alice)
+	}
+}
+
+func TestImportDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	src := path.Join(dir, "reviews.csv")
+	// the same medium may be reviewed by different critics, but only once by each of them
+	os.WriteFile(src, []byte("critic,score,media_url\nbob,4/5,/m/some_movie\nalice,3/5,/m/some_movie\nbob,1/5,/m/some_movie\n"), 0644)
+	out := path.Join(dir, "reviews")
+
+	result, err := Import(reviewsDataset, src, out, FORMAT_CSV, false)
+	if err == nil || len(result.BadRows) != 1 || result.BadRows[0].Line != 4 {
+		t.Fatalf("Expected line 4 to be a duplicate. Got %v (%v)", result.BadRows, err)
+	}
+
+	// with -skip-bad-rows, the first row wins
+	if _, err := Import(reviewsDataset, src, out, FORMAT_CSV, true); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	bob, _ := utils.ReadStructs[utils.Review](path.Join(out, "bob.gob"), false)
+	if len(bob) != 1 || bob[0].Score != "4/5" {
+		t.Errorf("Expected only the first review of bob. Got %+v", bob)
+	}
+
+	src = path.Join(dir, "critics.jsonl")
+	os.WriteFile(src, []byte(`{"url":"bob"}`+"\n"+`{"url":"bob","name":"Bob"}`+"\n"), 0644)
+	if result, _ := Import(criticsDataset, src, path.Join(dir, "critics.gob"), FORMAT_JSONL, false); len(result.BadRows) != 1 {
+		t.Errorf("Expected the second critic to be a duplicate. Got %v", result.BadRows)
+	}
+}
@@ -0,0 +1,99 @@
+package dataset
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Exports the dataset from src to out ("-" for stdout) in the given format. Returns the number of exported records.
+// Files are written to a temporary file first, so a failed export never leaves a partial file behind.
+func Export(d Dataset, src, out, format string, columns []string) (int, error) {
+	if out == "-" {
+		w, err := newRowWriter(format, os.Stdout)
+		if err != nil {
+			return 0, err
+		}
+		return d.export(src, columns, w)
+	}
+
+	fo, err := utils.CreateAtomic(out)
+	if err != nil {
+		return 0, err
+	}
+	w, err := newRowWriter(format, fo)
+	if err != nil {
+		fo.Abort()
+		return 0, err
+	}
+	written, err := d.export(src, columns, w)
+	if err != nil {
+		fo.Abort()
+		return 0, err
+	}
+	if err := fo.Commit(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// Prints the datasets and their columns
+func printDatasets(w io.Writer) {
+	fmt.Fprintln(w, "Datasets and their columns:")
+	for _, d := range Datasets {
+		fmt.Fprintf(w, "  %s: %s (default: %s)\n", d.Name(), d.Description(), d.DefaultPath())
+		descriptions := d.ColumnDescriptions()
+		for idx, column := range d.Columns() {
+			fmt.Fprintf(w, "    %s: %s\n", column, descriptions[idx])
+		}
+	}
+}
+
+func ExportMain(args []string) {
+	exportSet := flag.NewFlagSet("export", flag.ExitOnError)
+	var src = exportSet.String("i", "", "File or directory to read the dataset from (defaults to where the other commands write it)")
+	var out = exportSet.String("o", "-", "File to write to ('-' for stdout)")
+	var format = exportSet.String("format", "", "'csv' or 'jsonl' (defaults to the extension of -o, or 'csv')")
+	var columnList = exportSet.String("columns", "", "Comma separated columns to export, in that order (defaults to all)")
+	exportSet.Usage = func() {
+		fmt.Fprintln(exportSet.Output(), "Usage: export [flags] <dataset>")
+		exportSet.PrintDefaults()
+		printDatasets(exportSet.Output())
+	}
+	exportSet.Parse(args)
+
+	if exportSet.NArg() != 1 {
+		exportSet.Usage()
+		os.Exit(1)
+	}
+	d, err := Find(exportSet.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printDatasets(os.Stderr)
+		os.Exit(1)
+	}
+
+	if *src == "" {
+		*src = d.DefaultPath()
+	}
+	if *format == "" {
+		*format = formatOf(*out)
+	}
+	var columns []string
+	for _, column := range strings.Split(*columnList, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+
+	written, err := Export(d, *src, *out, *format, columns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d %s\n", written, d.Name())
+}
@@ -0,0 +1,270 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Formats datasets can be exported to and imported from
+const (
+	FORMAT_CSV   = "csv"
+	FORMAT_JSONL = "jsonl"
+)
+
+// Writes the rows of an exported dataset
+type rowWriter interface {
+	writeHeader(columns []string) error
+	writeRow(values []any) error
+	flush() error
+}
+
+// Returns the writer for the given format
+func newRowWriter(format string, w io.Writer) (rowWriter, error) {
+	switch format {
+	case FORMAT_CSV:
+		cw := csv.NewWriter(w)
+		cw.UseCRLF = true
+		return &csvRowWriter{w: cw}, nil
+	case FORMAT_JSONL:
+		return &jsonlRowWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format '%s'. Expected '%s' or '%s'", format, FORMAT_CSV, FORMAT_JSONL)
+}
+
+// Returns the format matching the extension of the file ("csv" for unknown extensions)
+func formatOf(file string) string {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".jsonl", ".ndjson":
+		return FORMAT_JSONL
+	}
+	return FORMAT_CSV
+}
+
+// Writes a header line with the column names followed by one line per row.
+// Unknown values are empty cells, lists are JSON arrays.
+type csvRowWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvRowWriter) writeHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvRowWriter) writeRow(values []any) error {
+	c.record = c.record[:0]
+	for _, value := range values {
+		cell, err := formatCell(value)
+		if err != nil {
+			return err
+		}
+		c.record = append(c.record, cell)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvRowWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatCell(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case []string:
+		if v == nil {
+			v = []string{}
+		}
+		list, err := json.Marshal(v)
+		return string(list), err
+	}
+	return "", fmt.Errorf("can't export value %v of type %T", value, value)
+}
+
+// Writes one JSON object per row with the columns as keys (in the selected order). Unknown values are null
+type jsonlRowWriter struct {
+	w       io.Writer
+	columns [][]byte
+	line    bytes.Buffer
+}
+
+func (j *jsonlRowWriter) writeHeader(columns []string) error {
+	for _, column := range columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		j.columns = append(j.columns, key)
+	}
+	return nil
+}
+
+func (j *jsonlRowWriter) writeRow(values []any) error {
+	j.line.Reset()
+	j.line.WriteByte('{')
+	for idx, value := range values {
+		if idx > 0 {
+			j.line.WriteByte(',')
+		}
+		j.line.Write(j.columns[idx])
+		j.line.WriteByte(':')
+		if list, ok := value.([]string); ok && list == nil {
+			value = []string{}
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		j.line.Write(encoded)
+	}
+	j.line.WriteString("}\n")
+	_, err := j.w.Write(j.line.Bytes())
+	return err
+}
+
+func (j *jsonlRowWriter) flush() error {
+	return nil
+}
+
+// Reads the rows of an imported dataset
+type rowReader interface {
+	// Returns the cells of the next row by column name and the line the row starts in.
+	// Returns a *RowError for rows that can't be parsed and io.EOF after the last row
+	next() (map[string]string, int, error)
+	// Names of the columns every row has (nil if rows can have different columns)
+	columns() []string
+}
+
+// Returns the reader for the given format
+func newRowReader(format string, r io.Reader) (rowReader, error) {
+	switch format {
+	case FORMAT_CSV:
+		return newCsvRowReader(r)
+	case FORMAT_JSONL:
+		return &jsonlRowReader{r: bufio.NewReader(r)}, nil
+	}
+	return nil, fmt.Errorf("unknown format '%s'. Expected '%s' or '%s'", format, FORMAT_CSV, FORMAT_JSONL)
+}
+
+// Reads files in the format written by csvRowWriter. The first line names the columns
+type csvRowReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCsvRowReader(r io.Reader) (*csvRowReader, error) {
+	c := &csvRowReader{r: csv.NewReader(r)}
+	header, err := c.r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing header line")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// spreadsheet programs like to start UTF-8 files with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	seen := make(map[string]bool)
+	for _, name := range header {
+		if seen[name] {
+			return nil, fmt.Errorf("column '%s' appears twice in the header", name)
+		}
+		seen[name] = true
+	}
+	c.header = header
+	// every row must have as many cells as the header
+	c.r.FieldsPerRecord = len(header)
+	return c, nil
+}
+
+func (c *csvRowReader) columns() []string {
+	return c.header
+}
+
+func (c *csvRowReader) next() (map[string]string, int, error) {
+	fields, err := c.r.Read()
+	if err == io.EOF {
+		return nil, 0, err
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, parseErr.StartLine, &RowError{Line: parseErr.StartLine, Err: parseErr.Err}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	line, _ := c.r.FieldPos(0)
+	cells := make(map[string]string, len(fields))
+	for idx, cell := range fields {
+		cells[c.header[idx]] = cell
+	}
+	return cells, line, nil
+}
+
+// Reads files in the format written by jsonlRowWriter. Blank lines are skipped.
+// The values are turned into the cells of the equivalent CSV file: strings are used as they are,
+// null is an empty cell and anything else (numbers, bools, lists) is kept as its JSON text.
+type jsonlRowReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (j *jsonlRowReader) next() (map[string]string, int, error) {
+	for {
+		text, err := j.r.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(text) == 0) {
+			return nil, 0, err
+		}
+		j.line++
+		text = bytes.TrimSpace(text)
+		if len(text) == 0 {
+			continue
+		}
+
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(text, &values); err != nil {
+			return nil, j.line, &RowError{Line: j.line, Err: err}
+		}
+		cells := make(map[string]string, len(values))
+		for name, value := range values {
+			cell, err := jsonCell(value)
+			if err != nil {
+				return nil, j.line, &RowError{Line: j.line, Err: fmt.Errorf("%s: %v", name, err)}
+			}
+			cells[name] = cell
+		}
+		return cells, j.line, nil
+	}
+}
+
+func (j *jsonlRowReader) columns() []string {
+	return nil
+}
+
+func jsonCell(value json.RawMessage) (string, error) {
+	switch {
+	case bytes.Equal(value, []byte("null")):
+		return "", nil
+	case value[0] == '"':
+		var cell string
+		err := json.Unmarshal(value, &cell)
+		return cell, err
+	}
+	return string(value), nil
+}
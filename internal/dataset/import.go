@@ -0,0 +1,78 @@
+package dataset
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Imports the dataset from src ("-" for stdin) in the given format and writes it to out.
+// All rows are validated first. If any of them is bad, nothing is written unless skipBadRows is set,
+// in which case only the good rows are imported. The bad rows are part of the result either way.
+// Datasets split per critic only replace the files of the critics that appear in src.
+func Import(d Dataset, src, out, format string, skipBadRows bool) (ImportResult, error) {
+	var r io.Reader = os.Stdin
+	if src != "-" {
+		fi, err := os.Open(src)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		defer fi.Close()
+		r = fi
+	}
+
+	rows, err := newRowReader(format, r)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return d.importRows(rows, out, skipBadRows)
+}
+
+func ImportMain(args []string) {
+	importSet := flag.NewFlagSet("import", flag.ExitOnError)
+	var src = importSet.String("i", "-", "File to read from ('-' for stdin)")
+	var out = importSet.String("o", "", "File or directory to write the dataset to (defaults to where the other commands read it from)")
+	var format = importSet.String("format", "", "'csv' or 'jsonl' (defaults to the extension of -i, or 'csv')")
+	var skipBadRows = importSet.Bool("skip-bad-rows", false, "Import the valid rows even if some rows are bad")
+	importSet.Usage = func() {
+		fmt.Fprintln(importSet.Output(), "Usage: import [flags] <dataset>")
+		importSet.PrintDefaults()
+		printDatasets(importSet.Output())
+	}
+	importSet.Parse(args)
+
+	if importSet.NArg() != 1 {
+		importSet.Usage()
+		os.Exit(1)
+	}
+	d, err := Find(importSet.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printDatasets(os.Stderr)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		*out = d.DefaultPath()
+	}
+	if *format == "" {
+		*format = formatOf(*src)
+	}
+
+	result, err := Import(d, *src, *out, *format, *skipBadRows)
+	for _, rowErr := range result.BadRows {
+		fmt.Fprintln(os.Stderr, rowErr)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if len(result.BadRows) > 0 && !*skipBadRows {
+			fmt.Fprintln(os.Stderr, "Fix the rows or use -skip-bad-rows to import the others")
+		}
+		os.Exit(1)
+	}
+	if len(result.BadRows) > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d bad rows\n", len(result.BadRows))
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d %s into %d files\n", result.Imported, d.Name(), len(result.Files))
+}
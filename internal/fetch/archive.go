@@ -0,0 +1,167 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Directory the raw responses are archived in by default
+const DefaultArchiveDir = "./tmp/archive"
+
+// http.RoundTripper that passes requests on to next and archives the body of every successful response in dir.
+// Every response is kept: the body is gzipped into <dir>/<key>/<fetch time in unix nanoseconds>.gz
+// with the URL stored in the gzip header, so all fetches of a URL end up next to each other.
+type archivingTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func newArchivingTransport(dir string, next http.RoundTripper) (*archivingTransport, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &archivingTransport{dir: dir, next: next}, nil
+}
+
+func (t *archivingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := archiveResponse(t.dir, req.URL.String(), time.Now(), body); err != nil {
+		return nil, fmt.Errorf("couldn't archive response: %w", err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// Writes the gzipped body of the response to url fetched at the given time into the archive
+func archiveResponse(dir, url string, fetched time.Time, body []byte) error {
+	urlDir := path.Join(dir, recordKey(url))
+	if err := os.MkdirAll(urlDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := utils.CreateAtomic(path.Join(urlDir, strconv.FormatInt(fetched.UnixNano(), 10)+".gz"))
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(tmp)
+	zw.Comment = url
+	zw.ModTime = fetched
+	if _, err := zw.Write(body); err != nil {
+		tmp.Abort()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Abort()
+		return err
+	}
+	return tmp.Commit()
+}
+
+// Returns the body of the latest archived response to url together with the time it was fetched.
+// Returns an error satisfying os.IsNotExist if url was never archived.
+func readArchived(dir, url string) ([]byte, time.Time, error) {
+	urlDir := path.Join(dir, recordKey(url))
+	entries, err := os.ReadDir(urlDir)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var latest int64 = -1
+	for _, entry := range entries {
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ".gz"), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), ".gz") {
+			continue
+		}
+		if nanos > latest {
+			latest = nanos
+		}
+	}
+	if latest < 0 {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+
+	file, err := os.Open(path.Join(urlDir, strconv.FormatInt(latest, 10)+".gz"))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("broken archive entry for %s: %w", url, err)
+	}
+	defer zr.Close()
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("broken archive entry for %s: %w", url, err)
+	}
+
+	return body, time.Unix(0, latest), nil
+}
+
+// http.RoundTripper that never touches the network but answers with the latest archived response.
+// Requests that were never archived are answered with 404.
+type archiveTransport struct {
+	dir string
+}
+
+func newArchiveTransport(dir string) (*archiveTransport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &archiveTransport{dir: dir}, nil
+}
+
+func (t *archiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	body, _, err := readArchived(t.dir, url)
+	if os.IsNotExist(err) {
+		return &http.Response{
+			Status:     "404 Not Found",
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{},
+			Body:       io.NopCloser(bytes.NewReader(nil)),
+			Request:    req,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+func TestReadArchived(t *testing.T) {
+	dir := t.TempDir()
+	const url = "https://example.com/critics/jane-doe/movies"
+	first := time.Date(2023, 9, 17, 12, 0, 0, 0, time.UTC)
+
+	if err := archiveResponse(dir, url, first, []byte("old")); err != nil {
+		t.Fatalf("Can't archive: %v", err)
+	}
+	if err := archiveResponse(dir, url, first.Add(time.Hour), []byte("new")); err != nil {
+		t.Fatalf("Can't archive: %v", err)
+	}
+
+	body, fetched, err := readArchived(dir, url)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if string(body) != "new" || !fetched.Equal(first.Add(time.Hour)) {
+		t.Errorf("Expected the latest response. Got '%s' fetched at %v", body, fetched)
+	}
+
+	if _, _, err := readArchived(dir, "https://example.com/never/fetched"); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error for URL that wasn't archived. Got %v", err)
+	}
+}
+
+func TestReparseFromArchive(t *testing.T) {
+	server := newTestServer(t)
+	f, _ := newTestFetcher(server)
+	dir := t.TempDir()
+	archiveDir := path.Join(dir, "archive")
+	criticsFile := path.Join(dir, "critics.gob")
+	mustWrite(t, []Critic{{Name: "Alice Example", Url: "alice-example"}}, criticsFile)
+
+	archiver, err := newArchivingTransport(archiveDir, server.Client().Transport)
+	if err != nil {
+		t.Fatalf("Can't create archiver: %v", err)
+	}
+	f.Client = &http.Client{Transport: archiver}
+	f.fetch_all_reviews(context.Background(), criticsFile, path.Join(dir, "crawled"), crawlOptions{workers: 1, mediaTypes: utils.MediaTypes})
+
+	// the server is gone, so everything has to come from the archive
+	server.Close()
+
+	reparser, err := newArchiveFetcher(server.URL, archiveDir, false)
+	if err != nil {
+		t.Fatalf("Can't create archive fetcher: %v", err)
+	}
+	reparser.fetch_all_reviews(context.Background(), criticsFile, path.Join(dir, "reparsed"), crawlOptions{workers: 1, fresh: true, mediaTypes: utils.MediaTypes})
+
+	crawled := mustRead[Review](t, path.Join(dir, "crawled", "alice-example.gob"))
+	reparsed := mustRead[Review](t, path.Join(dir, "reparsed", "alice-example.gob"))
+	if len(reparsed) != 4 || len(reparsed) != len(crawled) {
+		t.Fatalf("Expected the 4 crawled reviews. Got %d", len(reparsed))
+	}
+	for idx := range crawled {
+		if reparsed[idx].MediaUrl != crawled[idx].MediaUrl || reparsed[idx].Score != crawled[idx].Score {
+			t.Errorf("Expected review %v. Got %v", crawled[idx], reparsed[idx])
+		}
+	}
+}
+
+func TestReparseKeepsCrawlBookkeeping(t *testing.T) {
+	server := newTestServer(t)
+	f, _ := newTestFetcher(server)
+	dir := t.TempDir()
+	archiveDir := path.Join(dir, "archive")
+	outDir := path.Join(dir, "reviews")
+	criticsFile := path.Join(dir, "critics.gob")
+	mustWrite(t, []Critic{{Name: "Alice Example", Url: "alice-example"}, {Name: "Adam Sample", Url: "adam-sample"}}, criticsFile)
+
+	archiver, err := newArchivingTransport(archiveDir, server.Client().Transport)
+	if err != nil {
+		t.Fatalf("Can't create archiver: %v", err)
+	}
+	f.Client = &http.Client{Transport: archiver}
+	f.fetch_all_reviews(context.Background(), criticsFile, outDir, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes})
+	server.Close()
+
+	journal, err := os.ReadFile(path.Join(outDir, JOURNAL_FILE))
+	if err != nil {
+		t.Fatalf("Can't read journal: %v", err)
+	}
+	failures, err := os.ReadFile(path.Join(outDir, FAILURES_FILE))
+	if err != nil {
+		t.Fatalf("Can't read failure report: %v", err)
+	}
+
+	reparser, err := newArchiveFetcher(server.URL, archiveDir, false)
+	if err != nil {
+		t.Fatalf("Can't create archive fetcher: %v", err)
+	}
+	if err := reparser.reparse_all_reviews(context.Background(), criticsFile, outDir, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes}); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	if after, _ := os.ReadFile(path.Join(outDir, JOURNAL_FILE)); !bytes.Equal(after, journal) {
+		t.Errorf("Expected the journal of the crawl to be unchanged. Got\n%s", after)
+	}
+	if after, _ := os.ReadFile(path.Join(outDir, FAILURES_FILE)); !bytes.Equal(after, failures) {
+		t.Errorf("Expected the failure report of the crawl to be unchanged. Got\n%s", after)
+	}
+	states, err := readJournal(path.Join(outDir, REPARSE_JOURNAL_FILE))
+	if err != nil || states["alice-example"] != stateDone {
+		t.Errorf("Expected the reparse to have a journal of its own. Got %v (%v)", states, err)
+	}
+	// the 503 of adam-sample wasn't archived
+	reparseFailures, err := readFailureReport(path.Join(outDir, REPARSE_FAILURES_FILE))
+	if err != nil || len(reparseFailures) != 1 || reparseFailures[0].Url != "adam-sample" {
+		t.Errorf("Expected adam-sample in the failure report of the reparse. Got %v (%v)", reparseFailures, err)
+	}
+}
@@ -0,0 +1,139 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Default user agents to choose from. Without some spam filters kick in
+var USER_AGENTS = []string{
+	"Mozilla/5.0 (Linux; Android 12; moto g stylus 5G) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36",
+	"Mozilla/5.0 (Linux; Android 10; MAR-LX1A) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36",
+	"Mozilla/5.0 (iPhone9,4; U; CPU iPhone OS 10_0_1 like Mac OS X) AppleWebKit/602.1.50 (KHTML, like Gecko) Version/10.0 Mobile/14A403 Safari/602.1",
+	"Mozilla/5.0 (Linux; Android 7.0; Pixel C Build/NRD90M; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/52.0.2743.98 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/42.0.2311.135 Safari/537.36 Edge/12.246",
+}
+
+// Duration that is written as a string like "30s" in JSON
+type profileDuration time.Duration
+
+func (d *profileDuration) UnmarshalJSON(raw []byte) error {
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+	*d = profileDuration(parsed)
+	return nil
+}
+
+// Cookie that is sent with every request to the base URL
+type profileCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Describes how the HTTP client of the fetch subcommands looks to the site.
+// Loaded from the JSON file given with -client-profile, so it can be adjusted without recompiling.
+type ClientProfile struct {
+	// one of them is picked randomly for each request
+	UserAgents []string `json:"userAgents"`
+	// sent with every request
+	Headers map[string]string `json:"headers"`
+	// keep the cookies set by the site between requests
+	CookieJar bool `json:"cookieJar"`
+	// cookies to start with (implies cookieJar)
+	Cookies []profileCookie `json:"cookies"`
+	// e.g. "http://proxy:8080" or "socks5://127.0.0.1:1080". Uses the HTTP_PROXY environment variables if empty
+	Proxy string `json:"proxy"`
+	// for the whole request including reading the body
+	Timeout profileDuration `json:"timeout"`
+	// for establishing the connection
+	ConnectTimeout profileDuration `json:"connectTimeout"`
+}
+
+// Profile used if no -client-profile is given
+func DefaultClientProfile() ClientProfile {
+	return ClientProfile{
+		UserAgents:     USER_AGENTS,
+		Timeout:        profileDuration(time.Minute),
+		ConnectTimeout: profileDuration(30 * time.Second),
+	}
+}
+
+// Reads a client profile from a JSON file. Fields that aren't set keep the values of DefaultClientProfile
+func LoadClientProfile(fileName string) (ClientProfile, error) {
+	profile := DefaultClientProfile()
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return profile, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&profile); err != nil {
+		return profile, fmt.Errorf("invalid client profile %s: %w", fileName, err)
+	}
+	if len(profile.UserAgents) == 0 {
+		return profile, fmt.Errorf("invalid client profile %s: no user agents", fileName)
+	}
+	return profile, nil
+}
+
+// Creates the HTTP client described by the profile. Cookies are set for baseURL
+func (p ClientProfile) newClient(baseURL string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   time.Duration(p.ConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+
+	if p.Proxy != "" {
+		proxyUrl, err := url.Parse(p.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid proxy: unsupported scheme '%s'", proxyUrl.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(p.Timeout),
+	}
+
+	if p.CookieJar || len(p.Cookies) > 0 {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Cookies) > 0 {
+			base, err := url.Parse(baseURL)
+			if err != nil {
+				return nil, err
+			}
+			var cookies []*http.Cookie
+			for _, cookie := range p.Cookies {
+				cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			}
+			jar.SetCookies(base, cookies)
+		}
+		client.Jar = jar
+	}
+
+	return client, nil
+}
@@ -0,0 +1,96 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeProfile(t *testing.T, content string) string {
+	fileName := path.Join(t.TempDir(), "profile.json")
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatalf("Can't write profile: %v", err)
+	}
+	return fileName
+}
+
+func TestUserAgentsAreComplete(t *testing.T) {
+	for _, userAgent := range USER_AGENTS {
+		if !strings.HasPrefix(userAgent, "Mozilla/5.0 (") {
+			t.Errorf("Expected a complete user agent. Got '%s'", userAgent)
+		}
+	}
+}
+
+func TestLoadClientProfile(t *testing.T) {
+	fileName := writeProfile(t, `{
+		"userAgents": ["TestAgent/1.0"],
+		"headers": {"Accept-Language": "en-US"},
+		"proxy": "socks5://127.0.0.1:1080",
+		"timeout": "10s"
+	}`)
+
+	profile, err := LoadClientProfile(fileName)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if len(profile.UserAgents) != 1 || profile.Headers["Accept-Language"] != "en-US" {
+		t.Errorf("Expected user agents and headers of the file. Got %v", profile)
+	}
+	if time.Duration(profile.Timeout) != 10*time.Second {
+		t.Errorf("Expected timeout of 10s. Got %v", time.Duration(profile.Timeout))
+	}
+	if time.Duration(profile.ConnectTimeout) != time.Duration(DefaultClientProfile().ConnectTimeout) {
+		t.Errorf("Expected default connect timeout. Got %v", time.Duration(profile.ConnectTimeout))
+	}
+	if _, err := profile.newClient(DefaultBaseURL); err != nil {
+		t.Errorf("Expected socks5 proxy to be accepted. Got %v", err)
+	}
+
+	if _, err := LoadClientProfile(writeProfile(t, `{"userAgent": "typo"}`)); err == nil {
+		t.Errorf("Expected unknown fields to be an error")
+	}
+	profile.Proxy = "ftp://example.com"
+	if _, err := profile.newClient(DefaultBaseURL); err == nil {
+		t.Errorf("Expected unsupported proxy scheme to be an error")
+	}
+}
+
+func TestClientProfileIsUsed(t *testing.T) {
+	var req *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+	}))
+	defer server.Close()
+
+	opts := requestOptions{
+		baseURL: server.URL,
+		clientProfile: writeProfile(t, `{
+			"userAgents": ["TestAgent/1.0"],
+			"headers": {"Accept-Language": "en-US"},
+			"cookies": [{"name": "consent", "value": "yes"}]
+		}`),
+	}
+	f, err := opts.newFetcher()
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if _, err := f.sendRequest(context.Background(), server.URL+"/critics"); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	if ua := req.Header.Get("User-Agent"); ua != "TestAgent/1.0" {
+		t.Errorf("Expected user agent of the profile. Got '%s'", ua)
+	}
+	if lang := req.Header.Get("Accept-Language"); lang != "en-US" {
+		t.Errorf("Expected header of the profile. Got '%s'", lang)
+	}
+	if cookie, err := req.Cookie("consent"); err != nil || cookie.Value != "yes" {
+		t.Errorf("Expected cookie of the profile. Got %v (%v)", cookie, err)
+	}
+}
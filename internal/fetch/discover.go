@@ -0,0 +1,168 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+	"golang.org/x/net/html"
+)
+
+// Extracts the critics from a page of the reviews of a movie.
+// Returns a *PageStructureError if the page contains no critic links at all.
+func extractReviewCritics(body []byte) ([]Critic, error) {
+	var critics []Critic
+	found := false
+
+	err := forEachTag(body, "a", func(z *html.Tokenizer, attrs map[string]string) {
+		if attrs["data-qa"] != "review-critic-link" && !hasClass(attrs, "display-name") {
+			return
+		}
+		criticUrl, ok := criticUrlFromHref(attrs["href"])
+		if !ok {
+			return
+		}
+		found = true
+
+		name := readText(z, "a")
+		if name == "" {
+			return
+		}
+		critics = append(critics, Critic{Name: name, Url: criticUrl})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &PageStructureError{Missing: `critic links (<a data-qa="review-critic-link">)`}
+	}
+
+	return critics, nil
+}
+
+// Returns the URL of the given page of the reviews of a movie (e.g. "/m/some_movie")
+func (f *Fetcher) movieReviewsUrl(movieUrl string, page int) string {
+	return fmt.Sprintf("%s/reviews?page=%d", strings.TrimSuffix(f.mediaPageUrl(movieUrl), "/"), page)
+}
+
+// Fetches the pages of reviews of the given movie (up to maxPages, all of them if it's 0) and returns the critics who wrote them.
+// Stops early once a page contains no critic that wasn't on the pages before.
+func (f *Fetcher) fetch_movie_critics(ctx context.Context, movieUrl string, maxPages int) ([]Critic, error) {
+	var critics []Critic
+	seen := make(map[string]bool)
+
+	for page := 1; ; page++ {
+		if maxPages > 0 && page > maxPages {
+			fmt.Fprintf(os.Stderr, "Only fetched the first %d review pages of %s, there might be more critics\n", maxPages, movieUrl)
+			break
+		}
+		raw_body, err := f.sendRequest(ctx, f.movieReviewsUrl(movieUrl, page))
+		if err != nil {
+			if page > 1 {
+				return critics, &IncompleteError{Pages: page - 1, Err: err}
+			}
+			return nil, err
+		}
+
+		found, err := extractReviewCritics(raw_body)
+		if err != nil {
+			if page > 1 {
+				// the pages ran out
+				break
+			}
+			return nil, err
+		}
+
+		newCritics := 0
+		for _, critic := range found {
+			if seen[critic.Url] {
+				continue
+			}
+			seen[critic.Url] = true
+			critics = append(critics, critic)
+			newCritics++
+		}
+		if newCritics == 0 {
+			break
+		}
+	}
+
+	return critics, nil
+}
+
+// Adds the critics that aren't in existing yet (compared by Url). Returns the merged list and the number of added critics
+func mergeCritics(existing, found []Critic) ([]Critic, int) {
+	known := make(map[string]bool)
+	for _, critic := range existing {
+		known[critic.Url] = true
+	}
+
+	merged := existing
+	added := 0
+	for _, critic := range found {
+		if known[critic.Url] {
+			continue
+		}
+		known[critic.Url] = true
+		merged = append(merged, critic)
+		added++
+	}
+	return merged, added
+}
+
+// Collects the critics who reviewed the given movies and merges them into the critics file.
+// This finds critics that aren't listed in the A-Z index (e.g. because their names start with a digit).
+// The critics file is read before anything is fetched, so an unreadable file doesn't waste a crawl (or get overwritten).
+func (f *Fetcher) discover_critics(ctx context.Context, movieUrls []string, criticsFile string, maxPages, workers int, verbose bool) error {
+	var existing []Critic
+	if _, err := os.Stat(criticsFile); err == nil {
+		existing, err = utils.ReadStructs[Critic](criticsFile, verbose)
+		if err != nil {
+			return err
+		}
+	}
+
+	found := make([][]Critic, len(movieUrls))
+	errs := f.runParallel(ctx, len(movieUrls), workers, "Fetching movie reviews", func(ctx context.Context, idx int) error {
+		critics, err := f.fetch_movie_critics(ctx, movieUrls[idx], maxPages)
+		found[idx] = critics
+		if err != nil {
+			return fmt.Errorf("%s: %w", movieUrls[idx], err)
+		}
+		return nil
+	})
+	printErrors("Movies whose reviews couldn't be fetched", errs)
+
+	merged := existing
+	added := 0
+	for _, critics := range found {
+		var count int
+		merged, count = mergeCritics(merged, critics)
+		added += count
+	}
+	fmt.Printf("Found %d new critics (%d in total).\n", added, len(merged))
+
+	// the critics found before an interruption are merged as well
+	_, err := utils.WriteStructs(context.Background(), merged, criticsFile, false)
+	return err
+}
+
+// Returns the URLs of the distinct movies in the media file
+func readMovieUrls(mediaFile string, verbose bool) ([]string, error) {
+	media, err := utils.ReadStructs[utils.Media](mediaFile, verbose)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	seen := make(map[string]bool)
+	for _, medium := range media {
+		if medium.MediaType.OrDefault() != utils.MediaTypeMovie || seen[medium.MediaUrl] {
+			continue
+		}
+		seen[medium.MediaUrl] = true
+		urls = append(urls, medium.MediaUrl)
+	}
+	return urls, nil
+}
@@ -0,0 +1,170 @@
+package fetch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Error returned when a page doesn't contain the elements we're looking for.
+// This most likely means that the site changed its markup and the extraction code needs to be updated.
+type PageStructureError struct {
+	// Description of the element that is missing
+	Missing string
+}
+
+func (e *PageStructureError) Error() string {
+	return fmt.Sprintf("page structure changed: couldn't find %s", e.Missing)
+}
+
+// Reads the attributes of the start tag the tokenizer is currently at
+func readAttrs(z *html.Tokenizer) map[string]string {
+	attrs := make(map[string]string)
+	for {
+		key, val, more := z.TagAttr()
+		attrs[string(key)] = string(val)
+		if !more {
+			return attrs
+		}
+	}
+}
+
+func hasClass(attrs map[string]string, class string) bool {
+	for _, candidate := range strings.Fields(attrs["class"]) {
+		if candidate == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Collects the text inside the element whose start tag the tokenizer is currently at.
+// Entities are decoded and whitespace is collapsed.
+func readText(z *html.Tokenizer, tag string) string {
+	var text strings.Builder
+	depth := 1
+	for depth > 0 {
+		switch z.Next() {
+		case html.ErrorToken:
+			depth = 0
+		case html.TextToken:
+			text.Write(z.Text())
+			text.WriteString(" ")
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == tag {
+				depth++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == tag {
+				depth--
+			}
+		}
+	}
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// Calls visit for every start tag of the given kind in body. visit may consume further tokens.
+// Returns an error if the body isn't readable HTML.
+func forEachTag(body []byte, tag string, visit func(z *html.Tokenizer, attrs map[string]string)) error {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != tag {
+				continue
+			}
+			attrs := map[string]string{}
+			if hasAttr {
+				attrs = readAttrs(z)
+			}
+			visit(z, attrs)
+		}
+	}
+}
+
+// Returns the critic's URL part of a link to a critic page (e.g. "jane-doe" for "/critics/jane-doe/movies")
+func criticUrlFromHref(href string) (string, bool) {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(parsed.Path, "/critics/")
+	if !ok {
+		return "", false
+	}
+	criticUrl, _, _ := strings.Cut(rest, "/")
+	return criticUrl, criticUrl != ""
+}
+
+// Extracts the critics from a page of the critics index.
+// Returns a *PageStructureError if the page contains no critic links at all.
+func extractCritics(body []byte) ([]Critic, error) {
+	var critics []Critic
+	found := false
+
+	err := forEachTag(body, "a", func(z *html.Tokenizer, attrs map[string]string) {
+		if !hasClass(attrs, "critic-authors__name") {
+			return
+		}
+		found = true
+
+		criticUrl, ok := criticUrlFromHref(attrs["href"])
+		name := readText(z, "a")
+		if !ok || name == "" {
+			return
+		}
+		critics = append(critics, Critic{Name: name, Url: criticUrl})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &PageStructureError{Missing: `critic links (<a class="critic-authors__name">)`}
+	}
+
+	return critics, nil
+}
+
+// Returns the content of the first <script> element for which match returns true
+func extractScript(body []byte, match func(attrs map[string]string) bool) ([]byte, bool, error) {
+	var content []byte
+	found := false
+
+	err := forEachTag(body, "script", func(z *html.Tokenizer, attrs map[string]string) {
+		if found || !match(attrs) {
+			return
+		}
+		found = true
+		// the content of a script is a single raw text token
+		if z.Next() == html.TextToken {
+			content = append([]byte{}, z.Text()...)
+		}
+	})
+
+	return content, found, err
+}
+
+// Extracts the reviews JSON embedded in the first review page of a critic.
+// Returns a *PageStructureError if the page doesn't contain it.
+func extractReviewsJson(body []byte) ([]byte, error) {
+	content, found, err := extractScript(body, func(attrs map[string]string) bool {
+		return attrs["id"] == "reviews-json"
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found || len(bytes.TrimSpace(content)) == 0 {
+		return nil, &PageStructureError{Missing: `the reviews JSON (<script id="reviews-json">)`}
+	}
+	return content, nil
+}
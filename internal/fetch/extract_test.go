@@ -0,0 +1,92 @@
+package fetch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtractCritics(t *testing.T) {
+	body := []byte(`<ul>
+	<li><a data-qa="critic-item-link" href="/critics/jane-doe" class="critic-authors__name">Jane Doe</a></li>
+	<li><a class='critic-authors__name other-class'
+	       href="https://www.rottentomatoes.com/critics/jean-luc-d-arcy/movies">
+	       Jean-Luc d&#39;Arcy &amp; Co
+	   </a></li>
+	<li><a class="some-other-link" href="/critics/not-a-critic">Ignore me</a></li>
+</ul>`)
+
+	critics, err := extractCritics(body)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	expected := []Critic{
+		{Name: "Jane Doe", Url: "jane-doe"},
+		{Name: "Jean-Luc d'Arcy & Co", Url: "jean-luc-d-arcy"},
+	}
+	if len(critics) != len(expected) {
+		t.Fatalf("Expected %d critics. Got %v", len(expected), critics)
+	}
+	for idx := range expected {
+		if critics[idx].Name != expected[idx].Name || critics[idx].Url != expected[idx].Url {
+			t.Errorf("Expected critic %v. Got %v", expected[idx], critics[idx])
+		}
+	}
+}
+
+func TestExtractCriticsStructureChanged(t *testing.T) {
+	_, err := extractCritics([]byte(`<div class="critic-name"><a href="/critics/jane-doe">Jane Doe</a></div>`))
+
+	var structureErr *PageStructureError
+	if !errors.As(err, &structureErr) {
+		t.Errorf("Expected a PageStructureError. Got %v", err)
+	}
+}
+
+func TestExtractReviewsJson(t *testing.T) {
+	body := []byte(`<script type="application/json"
+		id="reviews-json">{"reviews":[{"quote":"</b> isn't the end"}]}</script>`)
+
+	json, err := extractReviewsJson(body)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if string(json) != `{"reviews":[{"quote":"</b> isn't the end"}]}` {
+		t.Errorf("Got unexpected JSON %s", string(json))
+	}
+
+	_, err = extractReviewsJson([]byte(`<script id="other-json">{}</script>`))
+	var structureErr *PageStructureError
+	if !errors.As(err, &structureErr) {
+		t.Errorf("Expected a PageStructureError. Got %v", err)
+	}
+}
+
+func TestParseCriticProfileOnlyReadsHeader(t *testing.T) {
+	// a regular critic on a page whose navigation and FAQ mention the badges of other critics
+	body := []byte(`<nav><a href="/faq">What does Tomatometer-approved mean?</a>
+	<span data-qa="critic-top-critic-info">Top Critics</span></nav>
+<div class="critic-header">
+	<h1 data-qa="critic-name">Bob Regular</h1>
+	<div class="links"><a data-qa="critic-publication-link" href="/source-3">Local Paper</a></div>
+	<p>Reviews: <span data-qa="critic-review-count">12</span></p>
+</div>
+<footer><p>Become a Tomatometer-approved critic</p><a data-qa="critic-publication-link" href="/source-4">Footer Paper</a></footer>`)
+
+	critic := Critic{Url: "bob-regular", TopCritic: true}
+	if err := parseCriticProfile(body, &critic); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if critic.TopCritic || critic.TomatometerApproved {
+		t.Errorf("Expected bob-regular to be neither a top critic nor approved. Got %v", critic)
+	}
+	if len(critic.Publications) != 1 || critic.Publications[0] != "Local Paper" || critic.ReviewCount != 12 {
+		t.Errorf("Expected the publication and review count of the header. Got %v", critic)
+	}
+
+	err := parseCriticProfile([]byte(`<div class="profile">Tomatometer-approved</div>`), &critic)
+	var structureErr *PageStructureError
+	if !errors.As(err, &structureErr) {
+		t.Errorf("Expected a PageStructureError for a page without profile header. Got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package fetch
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Name of the failure report placed inside the reviews output directory
+const FAILURES_FILE = "failures.json"
+
+// Name of the failure report of 'fetch reparse', which is kept apart from the one of the crawl
+const REPARSE_FAILURES_FILE = "reparse-failures.json"
+
+// Returned by fetch_and_write if a critic has no reviews at all
+var errNoReviews = errors.New("found no reviews")
+
+type failureKind string
+
+const (
+	// the server answered with a bad status code
+	failureStatus failureKind = "status"
+	// the request didn't get an answer at all
+	failureNetwork failureKind = "network"
+	// the reviews JSON didn't look like expected
+	failureSchema failureKind = "schema"
+	// the page didn't contain the expected elements
+	failurePageStructure failureKind = "page-structure"
+	// some of the pages were fetched, but the pagination stopped early
+	failureIncomplete failureKind = "incomplete"
+	failureNoReviews  failureKind = "no-reviews"
+	// robots.txt doesn't allow us to fetch the page
+	failureDisallowed failureKind = "disallowed"
+	failureOther      failureKind = "other"
+)
+
+// One critic that couldn't be fetched completely
+type failureEntry struct {
+	Url  string
+	Name string
+	Kind failureKind
+	// status code of the last failed request (0 if there was none)
+	StatusCode int `json:",omitempty"`
+	// number of review pages that were fetched before the error
+	Pages int
+	Error string
+	Time  time.Time
+}
+
+// Describes why fetching the reviews of critic failed
+func newFailureEntry(critic Critic, err error) failureEntry {
+	entry := failureEntry{
+		Url:   critic.Url,
+		Name:  critic.Name,
+		Kind:  failureOther,
+		Error: err.Error(),
+		Time:  time.Now(),
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		entry.StatusCode = statusErr.Code
+	}
+
+	var incompleteErr *IncompleteError
+	var schemaErr *SchemaError
+	var structureErr *PageStructureError
+	var netErr net.Error
+	var disallowedErr *DisallowedError
+	switch {
+	case errors.As(err, &incompleteErr):
+		entry.Kind = failureIncomplete
+		entry.Pages = incompleteErr.Pages
+	case errors.As(err, &disallowedErr):
+		entry.Kind = failureDisallowed
+	case errors.As(err, &schemaErr):
+		entry.Kind = failureSchema
+	case errors.As(err, &structureErr):
+		entry.Kind = failurePageStructure
+	case statusErr != nil:
+		entry.Kind = failureStatus
+	case errors.As(err, &netErr):
+		entry.Kind = failureNetwork
+	case errors.Is(err, errNoReviews):
+		entry.Kind = failureNoReviews
+	}
+
+	return entry
+}
+
+// Writes the failures of a fetch_all_reviews run into the failure report fileName, replacing the one of an earlier run
+func writeFailureReport(fileName string, failures []failureEntry) error {
+	if failures == nil {
+		failures = []failureEntry{}
+	}
+	content, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := utils.CreateAtomic(fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
+
+// Reads the failure report fileName
+func readFailureReport(fileName string) ([]failureEntry, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []failureEntry
+	if err := json.Unmarshal(content, &failures); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
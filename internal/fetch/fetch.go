@@ -3,64 +3,76 @@
 package fetch
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"math"
-	"math/rand"
 	"net/http"
 	"os"
-	"regexp"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/MamfTheKramf/critics_finder/internal/utils"
+	"github.com/MamfTheKramf/critics_finder/internal/workqueue"
 )
 
 type Critic = utils.Critic
 type Review = utils.Review
 
-// Fetches a list of all available critics and places them in the given outFile
-func fetch_critics(outFile string) {
+// Fetches a list of all available critics and places them in the given outFile.
+// Nothing is written if no critics could be found, e.g. because the structure of the index pages changed.
+func (f *Fetcher) fetch_critics(ctx context.Context, outFile string) error {
 	fmt.Println("Fetching critics...")
 	const alphabet = "abcdefghijklmnopqrstuvwxyz"
-	const url = "https://www.rottentomatoes.com/critics/authors?letter=%s"
+	const url = "%s/critics/authors?letter=%s"
 
 	// collect them
-	var critics []fmt.Stringer
-
-	regExp, err := regexp.Compile("<a class=\"critic-authors__name\" href=\"/critics/(.+)\" data-qa=\"critic-item-link\">(.+)</a>")
-	if err != nil {
-		panic(err)
-	}
+	var critics []Critic
+	var structureErr error
+	fetchedPages := 0
+	brokenPages := 0
 
 	for _, letter := range alphabet {
 		fmt.Printf("\rCritics of letter %s", string(letter))
 
-		resp, err := http.Get(fmt.Sprintf(url, string(letter)))
-		if err != nil {
-			panic(err)
+		raw_body, err := f.sendRequest(ctx, fmt.Sprintf(url, f.BaseURL, string(letter)))
+		if ctx.Err() != nil {
+			// don't replace a complete critics file with the critics of some letters
+			fmt.Println()
+			return ctx.Err()
 		}
-		defer resp.Body.Close()
-
-		raw_body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			fmt.Println(err)
 			continue
 		}
+		fetchedPages++
 
-		body := string(raw_body)
-
-		matches := regExp.FindAllStringSubmatch(body, -1)
-
-		for _, match := range matches {
-			critics = append(critics, Critic{Name: match[2], Url: match[1]})
+		found, err := extractCritics(raw_body)
+		if err != nil {
+			fmt.Printf("\rCritics of letter %s: %v\n", string(letter), err)
+			structureErr = err
+			brokenPages++
+			continue
 		}
+
+		critics = append(critics, found...)
 	}
 
 	fmt.Printf("\rFound %d critics.\n", len(critics))
 
+	if fetchedPages > 0 && brokenPages == fetchedPages {
+		return structureErr
+	}
+	if len(critics) == 0 {
+		return fmt.Errorf("found no critics")
+	}
+
 	// write them to a file
-	utils.WriteStructs(critics, outFile, false)
+	_, err := utils.WriteStructs(context.Background(), critics, outFile, false)
+	return err
 }
 
 type ReviewBatch struct {
@@ -69,38 +81,105 @@ type ReviewBatch struct {
 	prev    string
 }
 
+// Fields tagged with `schema:"required"` have to be present in every reviews JSON (see validateReviewsJson)
 type pageInfo struct {
-	HasNextPage     bool
+	HasNextPage     bool `schema:"required"`
 	HasPreviousPage bool
 	StartCursor     string
-	EndCursor       string
+	EndCursor       string `schema:"required"`
 }
 
 type rawReview struct {
-	OriginalScore string
-	MediaInfo     string
-	MediaTitle    string
-	MediaUrl      string
+	// missing for reviews that only have a sentiment
+	OriginalScore   string
+	MediaInfo       string
+	MediaTitle      string `schema:"required"`
+	MediaUrl        string `schema:"required"`
+	CreationDate    string
+	PublicationName string
+	// "POSITIVE" or "NEGATIVE"
+	ScoreSentiment string
+	IsFresh        bool
+	IsRotten       bool
+	Quote          string
+	ReviewUrl      string
+}
+
+// Layouts in which the creation date of a review might be given
+var reviewDateLayouts = []string{
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2006-01-02",
+	time.RFC3339,
+}
+
+// Parses the creation date of a review. Returns the zero time if the date can't be parsed
+func parseReviewDate(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range reviewDateLayouts {
+		if date, err := time.Parse(layout, raw); err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// Determines whether a review is fresh or rotten. Returns an empty sentiment if it's unknown
+func parseSentiment(rev rawReview) utils.Sentiment {
+	switch strings.ToUpper(rev.ScoreSentiment) {
+	case "POSITIVE", "FRESH":
+		return utils.SentimentFresh
+	case "NEGATIVE", "ROTTEN":
+		return utils.SentimentRotten
+	}
+	if rev.IsFresh {
+		return utils.SentimentFresh
+	}
+	if rev.IsRotten {
+		return utils.SentimentRotten
+	}
+	return ""
 }
 
 type rawResp struct {
-	PageInfo pageInfo
-	Reviews  []rawReview
+	PageInfo pageInfo    `schema:"required"`
+	Reviews  []rawReview `schema:"required"`
+}
+
+// Path segment of the review pages of the given media type
+func mediaPath(mediaType utils.MediaType) string {
+	if mediaType.OrDefault() == utils.MediaTypeTv {
+		return "tv"
+	}
+	return "movies"
 }
 
-// / converts a review JSON into a ReviewBatch instance
-func parseReviewBatch(json_raw []byte) ReviewBatch {
+// / converts a review JSON into a ReviewBatch instance. All reviews are tagged with the given media type.
+// Returns a *SchemaError if the JSON doesn't look like expected (see validateReviewsJson).
+func parseReviewBatch(json_raw []byte, mediaType utils.MediaType, strict bool) (ReviewBatch, error) {
+	if err := validateReviewsJson(json_raw, strict); err != nil {
+		return ReviewBatch{}, err
+	}
+
 	res := rawResp{}
-	json.Unmarshal(json_raw, &res)
+	if err := json.Unmarshal(json_raw, &res); err != nil {
+		return ReviewBatch{}, &SchemaError{Invalid: []string{err.Error()}}
+	}
 
 	var reviews []*Review
 
 	for _, rev := range res.Reviews {
 		reviews = append(reviews, &Review{
-			Score:      rev.OriginalScore,
-			MediaTitle: rev.MediaTitle,
-			MediaInfo:  rev.MediaInfo,
-			MediaUrl:   rev.MediaUrl,
+			Score:       rev.OriginalScore,
+			MediaTitle:  rev.MediaTitle,
+			MediaInfo:   rev.MediaInfo,
+			MediaUrl:    rev.MediaUrl,
+			MediaType:   mediaType,
+			Date:        parseReviewDate(rev.CreationDate),
+			Publication: rev.PublicationName,
+			Sentiment:   parseSentiment(rev),
+			Quote:       rev.Quote,
+			ReviewUrl:   rev.ReviewUrl,
 		})
 	}
 
@@ -110,118 +189,107 @@ func parseReviewBatch(json_raw []byte) ReviewBatch {
 		prev:    res.PageInfo.StartCursor,
 	}
 
-	return batch
+	return batch, nil
 }
 
-var USER_AGENTS = [15]string{
-	"Mozilla/5.0 (Linux; Android 12; moto g stylus 5G)",
-	"AppleWebKit/537.36 (KHTML, like Gecko)",
-	"Chrome/112.0.0.0 Mobile Safari/537.36v",
-	"Mozilla/5.0 (Linux; Android 10; MAR-LX1A)",
-	"AppleWebKit/537.36 (KHTML, like Gecko)",
-	"Chrome/112.0.0.0 Mobile Safari/537.36",
-	"Mozilla/5.0 (iPhone9,4; U; CPU iPhone OS 10_0_1 like Mac OS X)",
-	"AppleWebKit/602.1.50 (KHTML, like Gecko)",
-	"Version/10.0 Mobile/14A403 Safari/602.1",
-	"Mozilla/5.0 (Linux; Android 7.0; Pixel C Build/NRD90M; wv)",
-	"AppleWebKit/537.36 (KHTML, like Gecko)",
-	"Version/4.0 Chrome/52.0.2743.98 Safari/537.36",
-	"Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
-	"AppleWebKit/537.36 (KHTML, like Gecko)",
-	"Chrome/42.0.2311.135 Safari/537.36 Edge/12.246",
-}
-
-func sendRequest(url string) ([]byte, error) {
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", url, nil)
+// Fetch the first batch of reviews of the given media type of a critic
+func (f *Fetcher) getFirstBatch(ctx context.Context, critic *Critic, mediaType utils.MediaType) (*ReviewBatch, error) {
+	const url = "%s/critics/%s/%s"
+	reqUrl := fmt.Sprintf(url, f.BaseURL, critic.Url, mediaPath(mediaType))
+	raw_body, err := f.sendRequest(ctx, reqUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	idx := rand.Int31n(15)
-	userAgent := USER_AGENTS[idx]
-
-	// add some user agent because without some spam filters kick in
-	req.Header.Set("User-Agent", userAgent)
-
-	resp, err := client.Do(req)
+	// The first "movies" (or "tv") page of a critic has the reviews as a json hardcoded somewhere in the HTML.
+	json_raw, err := extractReviewsJson(raw_body)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	raw_body, err := io.ReadAll(resp.Body)
+	batch, err := parseReviewBatch(json_raw, mediaType, f.strictSchema)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		// fmt.Println("FUCK!")
-		// body := string(raw_body)
-		// fmt.Println(body)
-		return nil, fmt.Errorf("got bad status code %d", resp.StatusCode)
-	}
-
-	return raw_body, nil
+	return &batch, nil
 }
 
-// Fetch the first batch of reviews of a critic
-func getFirstBatch(critic *Critic) (*ReviewBatch, error) {
+// Get the ReviewBatch of the given media type of the given critic after the provided afterCursor.
+// afterCursor is used by RottenTomates for the pagination
+func (f *Fetcher) getBatch(ctx context.Context, critic *Critic, mediaType utils.MediaType, afterCursor string) (*ReviewBatch, error) {
+	const url = "%s/napi/critics/%s/%s?after=%s&pagecount=50"
+	reqUrl := fmt.Sprintf(url, f.BaseURL, critic.Url, mediaPath(mediaType), afterCursor)
 
-	// The first "movies" page of a critic has the reviews as a json hardcoded somewhere in the HTML.
-	// THis line is what we're interested in.
-	regexp, err := regexp.Compile("<script id=\"reviews-json\" .+?>({.+)</script>")
+	raw_body, err := f.sendRequest(ctx, reqUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	const url = "https://www.rottentomatoes.com/critics/%s/movies"
-	reqUrl := fmt.Sprintf(url, critic.Url)
-	raw_body, err := sendRequest(reqUrl)
+	batch, err := parseReviewBatch(raw_body, mediaType, f.strictSchema)
 	if err != nil {
 		return nil, err
 	}
-
-	body := string(raw_body)
-
-	match := regexp.FindStringSubmatch(body)
-	if len(match) < 2 {
-		return &ReviewBatch{
-			reviews: []*Review{},
-		}, nil
-	}
-
-	json_raw := []byte(match[1])
-
-	batch := parseReviewBatch(json_raw)
-
 	return &batch, nil
 }
 
-// Get the ReviewBatch of the given critic after the provided afterCursor.
-// afterCursor is used by RottenTomates for the pagination
-func getBatch(critic *Critic, afterCursor string) (*ReviewBatch, error) {
-	const url = "https://www.rottentomatoes.com/napi/critics/%s/movies?after=%s&pagecount=50"
-	reqUrl := fmt.Sprintf(url, critic.Url, afterCursor)
+// Fetch all the reviews of the given media types of a given critic.
+// A media type for which the critic has no review page at all is skipped.
+// If the pagination of a media type stops early or one of them fails completely, the reviews fetched so far are returned
+// together with an *IncompleteError naming the (first) failed media type.
+func (f *Fetcher) fetch_reviews(ctx context.Context, critic *Critic, mediaTypes []utils.MediaType, verbose bool) ([]*Review, error) {
+	return f.fetch_reviews_until(ctx, critic, mediaTypes, nil, verbose)
+}
 
-	raw_body, err := sendRequest(reqUrl)
-	if err != nil {
-		return nil, err
+// Fetch the reviews of the given media types of a given critic and stop each of them early when stop returns true.
+// See fetch_media_reviews_until
+func (f *Fetcher) fetch_reviews_until(ctx context.Context, critic *Critic, mediaTypes []utils.MediaType, stop func(*ReviewBatch) bool, verbose bool) ([]*Review, error) {
+	var reviews []*Review
+	var incompleteErr *IncompleteError
+
+	for _, mediaType := range mediaTypes {
+		if verbose {
+			fmt.Printf("Fetching %s reviews\n", mediaType)
+		}
+		fetched, err := f.fetch_media_reviews_until(ctx, critic, mediaType, stop, verbose)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound && len(mediaTypes) > 1 {
+			continue
+		}
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		var mediaErr *IncompleteError
+		if err != nil && !errors.As(err, &mediaErr) {
+			// the reviews of the other media types are still worth keeping
+			mediaErr = &IncompleteError{MediaType: mediaType, Err: err}
+		}
+		if mediaErr != nil && incompleteErr == nil {
+			incompleteErr = mediaErr
+		}
+		reviews = append(reviews, fetched...)
 	}
 
-	batch := parseReviewBatch(raw_body)
-	return &batch, nil
+	if incompleteErr != nil && incompleteErr.Pages == 0 && len(reviews) == 0 {
+		// nothing at all could be fetched
+		return nil, incompleteErr.Err
+	}
+	if incompleteErr != nil {
+		return reviews, incompleteErr
+	}
+	return reviews, nil
 }
 
-// Fetch all the reviews of a given critic
-func fetch_reviews(critic *Critic, verbose bool) ([]*Review, error) {
+// Fetch the reviews of the given media type of a given critic page by page until there are no more pages or stop returns true for a fetched batch.
+// The batch for which stop returned true is still included.
+// If the pagination stops early, the reviews fetched so far are returned together with an *IncompleteError.
+func (f *Fetcher) fetch_media_reviews_until(ctx context.Context, critic *Critic, mediaType utils.MediaType, stop func(*ReviewBatch) bool, verbose bool) ([]*Review, error) {
 	var reviews []*Review
 
 	if verbose {
 		fmt.Print("\rLoad Review page 1...")
 	}
-	batch, err := getFirstBatch(critic)
+	batch, err := f.getFirstBatch(ctx, critic, mediaType)
 	if err != nil {
 		return nil, err
 	}
@@ -230,20 +298,28 @@ func fetch_reviews(critic *Critic, verbose bool) ([]*Review, error) {
 	var page_count = 2
 
 	var next = batch.next
+	if stop != nil && stop(batch) {
+		next = ""
+	}
 	for len(next) > 0 {
 		if verbose {
 			fmt.Printf("\rLoad Review page %d...", page_count)
 		}
-		page_count += 1
 
-		batch, err = getBatch(critic, next)
+		batch, err = f.getBatch(ctx, critic, mediaType, next)
 		if err != nil {
-			fmt.Println(err)
-			break
+			if verbose {
+				fmt.Println()
+			}
+			return reviews, &IncompleteError{MediaType: mediaType, Pages: page_count - 1, Err: err}
 		}
+		page_count += 1
 
 		reviews = append(reviews, batch.reviews...)
 		next = batch.next
+		if stop != nil && stop(batch) {
+			break
+		}
 	}
 	if verbose {
 		fmt.Println()
@@ -252,139 +328,494 @@ func fetch_reviews(critic *Critic, verbose bool) ([]*Review, error) {
 	return reviews, nil
 }
 
-// Worker that getch a slice of critics, fetches all their reviews and writes them into the outDir.
-// Each time a critic is done, a bool is sent to the channel indicating success of failure for the critic
-func fetch_worker(channel chan<- bool, critics []Critic, outDir string, failChan chan<- []Critic) {
-	var failedCrititcs []Critic
-	for _, critic := range critics {
+// Fetches only the reviews of the given critic that are newer than the ones in existing and merges them into existing.
+// The pages are newest first, so the pagination stops at the first page containing an already known review.
+// Returns the merged reviews and the number of new reviews.
+func (f *Fetcher) refresh_reviews(ctx context.Context, critic *Critic, mediaTypes []utils.MediaType, existing []*Review) ([]*Review, int, error) {
+	known := make(map[string]bool, len(existing))
+	for _, review := range existing {
+		known[review.MediaUrl] = true
+	}
 
-		reviews, err := fetch_reviews(&critic, false)
-		if err != nil {
-			channel <- false
-			failedCrititcs = append(failedCrititcs, critic)
-			continue
-		}
-		if len(reviews) == 0 {
-			channel <- false
-			failedCrititcs = append(failedCrititcs, critic)
-			continue
+	fetched, err := f.fetch_reviews_until(ctx, critic, mediaTypes, func(batch *ReviewBatch) bool {
+		for _, review := range batch.reviews {
+			if known[review.MediaUrl] {
+				return true
+			}
 		}
+		return false
+	}, false)
+	if err != nil {
+		// merging an incomplete refresh would leave a gap that later refreshes never fill
+		return nil, 0, err
+	}
 
-		fileName := fmt.Sprintf("%s/%s.gob", outDir, critic.Url)
-		outFile, err := os.Create(fileName)
-		if err != nil {
-			channel <- false
-			failedCrititcs = append(failedCrititcs, critic)
-			continue
+	var merged []*Review
+	for _, review := range fetched {
+		if !known[review.MediaUrl] {
+			known[review.MediaUrl] = true
+			merged = append(merged, review)
 		}
+	}
+	newReviews := len(merged)
 
-		writtenStructs := utils.WriteStructs(reviews, outFile.Name(), false)
+	return append(merged, existing...), newReviews, nil
+}
 
-		if writtenStructs == 0 {
-			failedCrititcs = append(failedCrititcs, critic)
-			channel <- false
-		} else {
-			channel <- true
+// Settings of a fetch_all_reviews run
+type crawlOptions struct {
+	workers int
+	// ignore the journal of earlier runs
+	fresh bool
+	// only fetch the reviews that are newer than the ones already stored in outDir
+	refresh bool
+	// which kinds of reviews to fetch
+	mediaTypes []utils.MediaType
+	// abort the crawl after this many critics failed because the site changed
+	maxSchemaErrors int
+	// only fetch this many randomly picked critics (0 for all of them, see sampleCritics)
+	sample   int
+	seed     int64
+	stratify bool
+	verbose  bool
+	// names of the journal and the failure report inside outDir (JOURNAL_FILE and FAILURES_FILE if empty)
+	journalFile  string
+	failuresFile string
+}
+
+// Returns the paths of the journal and the failure report of a crawl into outDir
+func (opts crawlOptions) bookkeeping(outDir string) (journalFile, failuresFile string) {
+	journalFile, failuresFile = JOURNAL_FILE, FAILURES_FILE
+	if opts.journalFile != "" {
+		journalFile = opts.journalFile
+	}
+	if opts.failuresFile != "" {
+		failuresFile = opts.failuresFile
+	}
+	return path.Join(outDir, journalFile), path.Join(outDir, failuresFile)
+}
+
+// Stops a crawl once too many critics in a row failed because the pages or the API changed.
+// In that case all further critics would fail the same way, so there is no point in continuing.
+// A few odd pages spread over a long crawl don't mean that, so every successful critic starts the count again.
+type schemaGuard struct {
+	mu  sync.Mutex
+	max int
+	// errors of the critics that failed in a row
+	errs    []error
+	aborted bool
+	// stops the crawl
+	abort context.CancelFunc
+}
+
+// Returns whether err means that the site changed
+func isSchemaDrift(err error) bool {
+	var schemaErr *SchemaError
+	var structureErr *PageStructureError
+	return errors.As(err, &schemaErr) || errors.As(err, &structureErr)
+}
+
+// Remembers err if it means that the site changed and aborts the crawl if there were too many of them in a row.
+// A nil err (a successful critic) resets the count, other errors don't affect it
+func (g *schemaGuard) check(criticUrl string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err == nil {
+		g.errs = nil
+		return
+	}
+	if !isSchemaDrift(err) {
+		return
+	}
+	g.errs = append(g.errs, fmt.Errorf("%s: %w", criticUrl, err))
+	if g.max > 0 && len(g.errs) >= g.max && !g.aborted {
+		g.aborted = true
+		g.abort()
+	}
+}
+
+func (g *schemaGuard) stopped() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.aborted
+}
+
+// Fetches the reviews of a single critic of a crawl and records the outcome in the journal.
+// If ctx is cancelled in the meantime, ctx's error is returned without touching the journal again.
+// The critic then stays in progress, so it's fetched again on the next run.
+func (f *Fetcher) crawl_critic(ctx context.Context, critic Critic, outDir string, opts crawlOptions, jrnl *journal) error {
+	if err := jrnl.record(critic.Url, stateInProgress, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write journal: %v\n", err)
+	}
+
+	var err error
+	if opts.refresh {
+		err = f.refresh_and_write(ctx, &critic, outDir, opts.mediaTypes)
+	} else {
+		err = f.fetch_and_write(ctx, &critic, outDir, opts.mediaTypes)
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	state := stateDone
+	var incompleteErr *IncompleteError
+	if errors.As(err, &incompleteErr) {
+		state = stateIncomplete
+	} else if err != nil {
+		state = stateFailed
+	}
+	if err := jrnl.record(critic.Url, state, err); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write journal: %v\n", err)
+	}
+	return err
+}
+
+// Fetches all reviews of the given critic and writes them into a file inside outDir.
+// If only some of the review pages could be fetched, those reviews are written anyway and the *IncompleteError is returned.
+// Nothing is written if ctx is cancelled.
+func (f *Fetcher) fetch_and_write(ctx context.Context, critic *Critic, outDir string, mediaTypes []utils.MediaType) error {
+	reviews, fetchErr := f.fetch_reviews(ctx, critic, mediaTypes, false)
+	var incompleteErr *IncompleteError
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if fetchErr != nil && !errors.As(fetchErr, &incompleteErr) {
+		return fetchErr
+	}
+	if len(reviews) == 0 {
+		if fetchErr != nil {
+			return fetchErr
 		}
+		return errNoReviews
 	}
 
-	failChan <- failedCrititcs
+	fileName := path.Join(outDir, critic.Url+".gob")
+	if _, err := utils.WriteStructs(ctx, reviews, fileName, false); err != nil {
+		return err
+	}
+
+	return fetchErr
 }
 
-// Fetch the reviews of all the critivs in the criticsFile and write for each of the critics a file into outDir.
-func fetch_all_reviews(criticsFile, outDir string, workers int, verbose bool) {
-	// Still some issues with this one, but good enough
-	err := os.MkdirAll(outDir, os.ModePerm)
+// Updates the reviews file of the given critic inside outDir with the reviews that were added since it was written.
+// Critics without a (readable) reviews file are fetched completely.
+func (f *Fetcher) refresh_and_write(ctx context.Context, critic *Critic, outDir string, mediaTypes []utils.MediaType) error {
+	fileName := path.Join(outDir, critic.Url+".gob")
+	if _, err := os.Stat(fileName); err != nil {
+		return f.fetch_and_write(ctx, critic, outDir, mediaTypes)
+	}
+
+	existing, err := utils.ReadStructs[*Review](fileName, false)
+	if utils.IsCorrupt(err) {
+		fmt.Fprintf(os.Stderr, "%v. Fetching all reviews again\n", err)
+		return f.fetch_and_write(ctx, critic, outDir, mediaTypes)
+	}
+	if err != nil {
+		return err
+	}
+	merged, newReviews, err := f.refresh_reviews(ctx, critic, mediaTypes, existing)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if newReviews == 0 {
+		return nil
 	}
 
-	critics := utils.ReadStructs[Critic](criticsFile, verbose)
+	_, err = utils.WriteStructs(ctx, merged, fileName, false)
+	return err
+}
 
-	// set up workers
-	channel := make(chan bool, 1)
-	defer close(channel)
-	failChannel := make(chan []Critic, workers)
-	defer close(failChannel)
+// Fetch the reviews of all the critivs in the criticsFile and write for each of the critics a file into outDir.
+// Critics that are marked as done in the journal of outDir are skipped, unless opts.fresh is set.
+// When ctx is cancelled, the critics in progress are rolled back and the summary is printed as usual.
+func (f *Fetcher) fetch_all_reviews(ctx context.Context, criticsFile, outDir string, opts crawlOptions) error {
+	critics, err := utils.ReadStructs[Critic](criticsFile, opts.verbose)
+	if err != nil {
+		return err
+	}
+	if opts.sample > 0 {
+		critics = sampleCritics(critics, opts.sample, opts.seed, opts.stratify)
+		if opts.verbose {
+			fmt.Printf("Sampled %d critics (seed %d)\n", len(critics), opts.seed)
+		}
+	}
+	return f.crawl_critics(ctx, critics, outDir, opts, nil)
+}
 
-	stepSize := int(math.Ceil(float64(len(critics)) / float64(workers)))
+// Rebuilds the reviews files of all critics in criticsFile inside outDir. f should answer from an archive (see newArchiveFetcher).
+// Every critic is parsed again, no matter what the journal of the crawl says. The reparse keeps its own journal and failure report,
+// so the ones of the crawl stay usable for resuming and retrying it.
+func (f *Fetcher) reparse_all_reviews(ctx context.Context, criticsFile, outDir string, opts crawlOptions) error {
+	opts.fresh = true
+	opts.journalFile = REPARSE_JOURNAL_FILE
+	opts.failuresFile = REPARSE_FAILURES_FILE
+	return f.fetch_all_reviews(ctx, criticsFile, outDir, opts)
+}
 
-	for i := 0; i < workers; i++ {
-		lower := i * stepSize
-		upper := utils.Min(len(critics), lower+stepSize)
+// Fetches the reviews of the critics listed in the failure report inside outDir again.
+// Only failures of the given kinds are retried (all of them if kinds is empty).
+func (f *Fetcher) retry_failed(ctx context.Context, outDir string, kinds []failureKind, opts crawlOptions) error {
+	_, failuresFile := opts.bookkeeping(outDir)
+	failures, err := readFailureReport(failuresFile)
+	if err != nil {
+		return err
+	}
 
-		go fetch_worker(channel, critics[lower:upper], outDir, failChannel)
+	var critics []Critic
+	var kept []failureEntry
+	for _, failure := range failures {
+		if len(kinds) > 0 && !containsKind(kinds, failure.Kind) {
+			kept = append(kept, failure)
+			continue
+		}
+		critics = append(critics, Critic{Name: failure.Name, Url: failure.Url})
 	}
+	if len(critics) == 0 {
+		fmt.Println("No failed critics to retry")
+		return nil
+	}
+	fmt.Printf("Retrying %d of %d failed critics\n", len(critics), len(failures))
 
-	doneTotal := 0
-	finished := 0
-	errors := 0
+	// the failures that aren't retried stay in the report
+	return f.crawl_critics(ctx, critics, outDir, opts, append(kept, failuresOf(failures, critics)...))
+}
 
-	for doneTotal < len(critics) {
-		res := <-channel
-		doneTotal++
-		if res {
-			finished++
-		} else {
-			errors++
+func containsKind(kinds []failureKind, kind failureKind) bool {
+	for _, candidate := range kinds {
+		if candidate == kind {
+			return true
 		}
+	}
+	return false
+}
 
-		if verbose && doneTotal&10 == 0 {
-			fmt.Printf("%.2f%% done; %d finished; %d errors\r",
-				100.0*float32(doneTotal)/float32(len(critics)),
-				finished,
-				errors)
+// Returns the failures of the given critics
+func failuresOf(failures []failureEntry, critics []Critic) []failureEntry {
+	urls := make(map[string]bool, len(critics))
+	for _, critic := range critics {
+		urls[critic.Url] = true
+	}
+	var res []failureEntry
+	for _, failure := range failures {
+		if urls[failure.Url] {
+			res = append(res, failure)
 		}
 	}
-	if verbose {
-		fmt.Printf("%.2f%% done; %d finished; %d errors\r",
-			100.0*float32(doneTotal)/float32(len(critics)),
-			finished,
-			errors)
+	return res
+}
+
+// Fetches the reviews of the given critics and writes for each of them a file into outDir.
+// The failures are written to the failure report inside outDir. previous are the failures of an earlier run;
+// they're kept in the report for the critics that aren't attempted this time (e.g. because the run was interrupted).
+// Only returns an error if the crawl couldn't be started; failed critics end up in the failure report instead.
+func (f *Fetcher) crawl_critics(ctx context.Context, allCritics []Critic, outDir string, opts crawlOptions, previous []failureEntry) error {
+	verbose := opts.verbose
+
+	// Still some issues with this one, but good enough
+	err := os.MkdirAll(outDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("couldn't create output directory: %w", err)
+	}
+
+	journalFile, failuresFile := opts.bookkeeping(outDir)
+	jrnl, err := openJournal(journalFile, opts.fresh)
+	if err != nil {
+		return fmt.Errorf("couldn't open journal: %w", err)
 	}
+	defer jrnl.Close()
+
+	var critics []Critic
+	skipped := 0
+	for _, critic := range allCritics {
+		if jrnl.state(critic.Url) == stateDone {
+			skipped++
+			continue
+		}
+		critics = append(critics, critic)
+	}
+	if verbose && skipped > 0 {
+		fmt.Printf("Skipping %d critics that are already done according to the journal\n", skipped)
+	}
+
+	// the guard cancels runCtx to abort the crawl
+	runCtx, abort := context.WithCancel(ctx)
+	defer abort()
+	guard := &schemaGuard{max: opts.maxSchemaErrors, abort: abort}
+
+	var mu sync.Mutex
+	var failures []failureEntry
+	attempted := make(map[string]bool)
+	progress, _ := workqueue.Run(runCtx, len(critics), workqueue.Options{
+		Workers:  opts.workers,
+		Label:    "Fetching reviews",
+		Reporter: f.progress,
+	}, func(ctx context.Context, idx int) error {
+		critic := critics[idx]
+		err := f.crawl_critic(ctx, critic, outDir, opts, jrnl)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+
+		mu.Lock()
+		attempted[critic.Url] = true
+		if err != nil {
+			failures = append(failures, newFailureEntry(critic, err))
+		}
+		mu.Unlock()
+		guard.check(critic.Url, err)
+		return err
+	})
 
 	fmt.Println("Critics where issues occured")
-	for i := 0; i < workers; i++ {
-		failed := <-failChannel
+	for _, failure := range failures {
+		fmt.Printf("%s (%s)\n", failure.Url, failure.Kind)
+	}
 
-		for _, failedCritic := range failed {
-			fmt.Println(failedCritic.Url)
+	for _, failure := range previous {
+		if !attempted[failure.Url] {
+			failures = append(failures, failure)
 		}
 	}
+	if err := writeFailureReport(failuresFile, failures); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write failure report: %v\n", err)
+	} else if len(failures) > 0 && opts.failuresFile == "" {
+		fmt.Printf("Wrote %d failures to %s. Run 'fetch retry-failed' to fetch them again.\n", len(failures), failuresFile)
+	} else if len(failures) > 0 {
+		fmt.Printf("Wrote %d failures to %s\n", len(failures), failuresFile)
+	}
+
+	if guard.stopped() {
+		fmt.Fprintf(os.Stderr, "\nAborted after %d critics in a row failed because the site seems to have changed:\n", len(guard.errs))
+		for _, err := range guard.errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Fprintf(os.Stderr, "%d critics were not attempted. Fix the parsing code and run the command again to continue.\n", len(critics)-progress.Done)
+	} else if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "\nInterrupted. %d critics were not fetched. Run the command again to continue.\n", len(critics)-progress.Done)
+	}
+
+	fmt.Printf("Journal: %d critics done; %d critics incomplete; %d critics failed\n",
+		jrnl.count(stateDone),
+		jrnl.count(stateIncomplete),
+		jrnl.count(stateFailed))
+	return nil
 }
 
 const (
 	FETCH_CRITICS     = "critics"
 	FETCH_REVIEWS     = "reviews"
 	FETCH_ALL_REVIEWS = "all-reviews"
+	FETCH_PROFILES    = "profiles"
+	FETCH_MEDIA       = "media"
+	FETCH_DISCOVER    = "discover"
+	FETCH_RETRY       = "retry-failed"
+	FETCH_REPARSE     = "reparse"
 )
 
+// Prints err and exits with a non-zero status
+func exitWith(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
 func FetchMain(args []string) {
 	fetchCriticsSet := flag.NewFlagSet(FETCH_CRITICS, flag.ExitOnError)
 	var outFile = fetchCriticsSet.String("o", utils.DefaultCriticsFile, "Path to the out-file")
+	var criticsOpts = addRequestFlags(fetchCriticsSet)
 
 	fetchReviewsSet := flag.NewFlagSet(FETCH_REVIEWS, flag.ExitOnError)
 	var criticUrl = fetchReviewsSet.String("c", "", "URL of critic to get reviews from")
+	var reviewsMedia = fetchReviewsSet.String("media", "all", "Which reviews to fetch ('movie', 'tv' or 'all')")
+	var reviewsOpts = addRequestFlags(fetchReviewsSet)
 
 	fetchAllReviewsSet := flag.NewFlagSet(FETCH_ALL_REVIEWS, flag.ExitOnError)
 	var criticsFile = fetchAllReviewsSet.String("i", utils.DefaultCriticsFile, "Path to critics file (CSV)")
 	var outDir = fetchAllReviewsSet.String("o", utils.DefaultReviewsDir, "Path to output directory (will be created if doesn't exist)")
 	var workers = fetchAllReviewsSet.Int("w", 1, "Number of workers to fetch all reviews")
+	var fresh = fetchAllReviewsSet.Bool("fresh", false, "Ignore the journal of a previous run and fetch all critics again")
+	var allReviewsMedia = fetchAllReviewsSet.String("media", "all", "Which reviews to fetch ('movie', 'tv' or 'all')")
+	var maxSchemaErrors = fetchAllReviewsSet.Int("max-schema-errors", 3, "Abort after this many critics in a row failed because the page structure or the API changed (0 to never abort)")
+	var refresh = fetchAllReviewsSet.Bool("refresh", false, "Only fetch reviews that are newer than the ones already stored in the output directory and merge them in")
+	var sample = fetchAllReviewsSet.Int("sample", 0, "Only fetch this many randomly picked critics (0 for all)")
+	var seed = fetchAllReviewsSet.Int64("seed", 1, "Seed for -sample. The same seed picks the same critics from the same critics file")
+	var stratify = fetchAllReviewsSet.Bool("stratify", false, "Make -sample pick critics of each first letter according to their share of all critics")
+	var allReviewsOpts = addRequestFlags(fetchAllReviewsSet)
+
+	fetchProfilesSet := flag.NewFlagSet(FETCH_PROFILES, flag.ExitOnError)
+	var profilesCriticsFile = fetchProfilesSet.String("i", utils.DefaultCriticsFile, "Path to critics file")
+	var profilesOutFile = fetchProfilesSet.String("o", "", "Path to write the critics including their profiles to (defaults to the critics file)")
+	var profilesWorkers = fetchProfilesSet.Int("w", 1, "Number of workers to fetch the profiles")
+	var profilesOpts = addRequestFlags(fetchProfilesSet)
+
+	fetchMediaSet := flag.NewFlagSet(FETCH_MEDIA, flag.ExitOnError)
+	var mediaFile = fetchMediaSet.String("i", utils.DefaultMediaFile, "Path to media file (written by normalize)")
+	var mediaOutFile = fetchMediaSet.String("o", "", "Path to write the media including their metadata to (defaults to the media file)")
+	var mediaWorkers = fetchMediaSet.Int("w", 1, "Number of workers to fetch the media pages")
+	var mediaOpts = addRequestFlags(fetchMediaSet)
+
+	fetchRetrySet := flag.NewFlagSet(FETCH_RETRY, flag.ExitOnError)
+	var retryOutDir = fetchRetrySet.String("o", utils.DefaultReviewsDir, "Path to the output directory of 'fetch all-reviews' containing the failure report")
+	var retryWorkers = fetchRetrySet.Int("w", 1, "Number of workers to fetch the reviews")
+	var retryKinds = fetchRetrySet.String("kind", "", "Comma separated kinds of failures to retry (e.g. 'status,network,incomplete'). Retries all failures if empty")
+	var retryMedia = fetchRetrySet.String("media", "all", "Which reviews to fetch ('movie', 'tv' or 'all')")
+	var retryMaxSchemaErrors = fetchRetrySet.Int("max-schema-errors", 3, "Abort after this many critics in a row failed because the page structure or the API changed (0 to never abort)")
+	var retryRefresh = fetchRetrySet.Bool("refresh", false, "Only fetch reviews that are newer than the ones already stored in the output directory and merge them in")
+	var retryOpts = addRequestFlags(fetchRetrySet)
+
+	fetchReparseSet := flag.NewFlagSet(FETCH_REPARSE, flag.ExitOnError)
+	var reparseArchive = fetchReparseSet.String("archive", DefaultArchiveDir, "Directory containing the responses archived with -archive")
+	var reparseBaseURL = fetchReparseSet.String("base-url", DefaultBaseURL, "Base URL the archived responses were fetched from")
+	var reparseCriticsFile = fetchReparseSet.String("i", utils.DefaultCriticsFile, "Path to critics file")
+	var reparseOutDir = fetchReparseSet.String("o", utils.DefaultReviewsDir, "Path to output directory (will be created if doesn't exist)")
+	var reparseWorkers = fetchReparseSet.Int("w", 1, "Number of workers to parse the reviews")
+	var reparseMedia = fetchReparseSet.String("media", "all", "Which reviews to parse ('movie', 'tv' or 'all')")
+	var reparseStrictSchema = fetchReparseSet.Bool("strict-schema", false, "Treat unknown fields in the reviews JSON as errors")
+	var reparseMaxSchemaErrors = fetchReparseSet.Int("max-schema-errors", 3, "Abort after this many critics in a row failed because the page structure or the API changed (0 to never abort)")
+	var reparseProgress = workqueue.AddFlag(fetchReparseSet)
+
+	fetchDiscoverSet := flag.NewFlagSet(FETCH_DISCOVER, flag.ExitOnError)
+	var discoverMovies = fetchDiscoverSet.String("m", "", "Comma separated URLs of the movies to start from (e.g. \"/m/some_movie\"). If not given, all movies of the media file are used")
+	var discoverMediaFile = fetchDiscoverSet.String("media-file", utils.DefaultMediaFile, "Path to media file (written by normalize) to take the movies from")
+	var discoverCriticsFile = fetchDiscoverSet.String("c", utils.DefaultCriticsFile, "Path to the critics file to merge the found critics into (will be created if doesn't exist)")
+	var discoverPages = fetchDiscoverSet.Int("pages", 0, "Maximum number of review pages to fetch per movie (0 for all of them)")
+	var discoverWorkers = fetchDiscoverSet.Int("w", 1, "Number of workers to fetch the movie reviews")
+	var discoverOpts = addRequestFlags(fetchDiscoverSet)
 
 	if len(args) < 1 {
 		fmt.Fprintf(os.Stderr, "Expect arguments")
 		os.Exit(1)
 	}
 
+	ctx, stop := utils.InterruptContext()
+	defer stop()
+
 	switch args[0] {
 	case FETCH_CRITICS:
 		fetchCriticsSet.Parse(args[1:])
-		fetch_critics(*outFile)
+		f, err := criticsOpts.newFetcher()
+		if err != nil {
+			exitWith(err)
+		}
+		if err := f.fetch_critics(ctx, *outFile); err != nil {
+			exitWith(err)
+		}
 	case FETCH_REVIEWS:
 		fetchReviewsSet.Parse(args[1:])
-		reviews, err := fetch_reviews(&Critic{Name: "", Url: *criticUrl}, true)
+		mediaTypes, err := utils.ParseMediaTypes(*reviewsMedia)
 		if err != nil {
-			panic(err)
+			exitWith(err)
+		}
+		f, err := reviewsOpts.newFetcher()
+		if err != nil {
+			exitWith(err)
+		}
+		reviews, err := f.fetch_reviews(ctx, &Critic{Name: "", Url: *criticUrl}, mediaTypes, true)
+		var incompleteErr *IncompleteError
+		if errors.As(err, &incompleteErr) {
+			fmt.Fprintf(os.Stderr, "Reviews are incomplete: %v\n", err)
+		} else if err != nil {
+			exitWith(err)
 		}
 
 		fmt.Printf("Found %d reviews\n", len(reviews))
@@ -393,10 +824,127 @@ func FetchMain(args []string) {
 		}
 	case FETCH_ALL_REVIEWS:
 		fetchAllReviewsSet.Parse(args[1:])
-		fetch_all_reviews(*criticsFile, *outDir, *workers, true)
+		mediaTypes, err := utils.ParseMediaTypes(*allReviewsMedia)
+		if err != nil {
+			exitWith(err)
+		}
+		f, err := allReviewsOpts.newFetcher()
+		if err != nil {
+			exitWith(err)
+		}
+		err = f.fetch_all_reviews(ctx, *criticsFile, *outDir, crawlOptions{
+			workers:         *workers,
+			fresh:           *fresh,
+			refresh:         *refresh,
+			mediaTypes:      mediaTypes,
+			maxSchemaErrors: *maxSchemaErrors,
+			sample:          *sample,
+			seed:            *seed,
+			stratify:        *stratify,
+			verbose:         true,
+		})
+		if err != nil {
+			exitWith(err)
+		}
+	case FETCH_RETRY:
+		fetchRetrySet.Parse(args[1:])
+		mediaTypes, err := utils.ParseMediaTypes(*retryMedia)
+		if err != nil {
+			exitWith(err)
+		}
+		var kinds []failureKind
+		for _, kind := range strings.Split(*retryKinds, ",") {
+			if kind = strings.TrimSpace(kind); kind != "" {
+				kinds = append(kinds, failureKind(kind))
+			}
+		}
+		f, err := retryOpts.newFetcher()
+		if err != nil {
+			exitWith(err)
+		}
+		err = f.retry_failed(ctx, *retryOutDir, kinds, crawlOptions{
+			workers:         *retryWorkers,
+			refresh:         *retryRefresh,
+			mediaTypes:      mediaTypes,
+			maxSchemaErrors: *retryMaxSchemaErrors,
+			verbose:         true,
+		})
+		if err != nil {
+			exitWith(err)
+		}
+	case FETCH_REPARSE:
+		fetchReparseSet.Parse(args[1:])
+		mediaTypes, err := utils.ParseMediaTypes(*reparseMedia)
+		if err != nil {
+			exitWith(err)
+		}
+		f, err := newArchiveFetcher(*reparseBaseURL, *reparseArchive, *reparseStrictSchema)
+		if err != nil {
+			exitWith(err)
+		}
+		f.progress, err = reparseProgress()
+		if err != nil {
+			exitWith(err)
+		}
+		err = f.reparse_all_reviews(ctx, *reparseCriticsFile, *reparseOutDir, crawlOptions{
+			workers:         *reparseWorkers,
+			mediaTypes:      mediaTypes,
+			maxSchemaErrors: *reparseMaxSchemaErrors,
+			verbose:         true,
+		})
+		if err != nil {
+			exitWith(err)
+		}
+	case FETCH_PROFILES:
+		fetchProfilesSet.Parse(args[1:])
+		if *profilesOutFile == "" {
+			*profilesOutFile = *profilesCriticsFile
+		}
+		f, err := profilesOpts.newFetcher()
+		if err != nil {
+			exitWith(err)
+		}
+		if err := f.fetch_profiles(ctx, *profilesCriticsFile, *profilesOutFile, *profilesWorkers, true); err != nil {
+			exitWith(err)
+		}
+	case FETCH_MEDIA:
+		fetchMediaSet.Parse(args[1:])
+		if *mediaOutFile == "" {
+			*mediaOutFile = *mediaFile
+		}
+		f, err := mediaOpts.newFetcher()
+		if err != nil {
+			exitWith(err)
+		}
+		if err := f.fetch_all_media(ctx, *mediaFile, *mediaOutFile, *mediaWorkers, true); err != nil {
+			exitWith(err)
+		}
+	case FETCH_DISCOVER:
+		fetchDiscoverSet.Parse(args[1:])
+		var movieUrls []string
+		var err error
+		if *discoverMovies != "" {
+			for _, movieUrl := range strings.Split(*discoverMovies, ",") {
+				if movieUrl = strings.TrimSpace(movieUrl); movieUrl != "" {
+					movieUrls = append(movieUrls, movieUrl)
+				}
+			}
+		} else {
+			movieUrls, err = readMovieUrls(*discoverMediaFile, true)
+			if err != nil {
+				exitWith(err)
+			}
+		}
+		f, err := discoverOpts.newFetcher()
+		if err != nil {
+			exitWith(err)
+		}
+		if err := f.discover_critics(ctx, movieUrls, *discoverCriticsFile, *discoverPages, *discoverWorkers, true); err != nil {
+			exitWith(err)
+		}
 	default:
 		fmt.Printf("Unkown command \"%s\"\n", args[0])
-		fmt.Printf("Available commands are: %s, %s, %s\n", FETCH_CRITICS, FETCH_REVIEWS, FETCH_ALL_REVIEWS)
+		fmt.Printf("Available commands are: %s, %s, %s, %s, %s, %s, %s, %s\n", FETCH_CRITICS, FETCH_REVIEWS, FETCH_ALL_REVIEWS, FETCH_RETRY, FETCH_REPARSE, FETCH_PROFILES, FETCH_MEDIA, FETCH_DISCOVER)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,619 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Clock that doesn't sleep but remembers how long it was asked to
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// Serves the recorded pages in testdata the same way Rotten Tomatoes does
+func newTestServer(t *testing.T) *httptest.Server {
+	serveFile := func(w http.ResponseWriter, name string) {
+		content, err := os.ReadFile(path.Join("testdata", name))
+		if err != nil {
+			t.Errorf("Can't read test data: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(content)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/critics/authors", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("letter") == "a" {
+			serveFile(w, "critics_a.html")
+			return
+		}
+		w.Write([]byte("<html><body></body></html>"))
+	})
+	mux.HandleFunc("/critics/alice-example/movies", func(w http.ResponseWriter, r *http.Request) {
+		serveFile(w, "alice-example_movies.html")
+	})
+	mux.HandleFunc("/m/first_movie", func(w http.ResponseWriter, r *http.Request) {
+		serveFile(w, "first_movie.html")
+	})
+	mux.HandleFunc("/m/first_movie/reviews", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "1" {
+			w.Write([]byte("<html><body></body></html>"))
+			return
+		}
+		serveFile(w, "first_movie_reviews.html")
+	})
+	mux.HandleFunc("/critics/alice-example", func(w http.ResponseWriter, r *http.Request) {
+		serveFile(w, "alice-example_profile.html")
+	})
+	mux.HandleFunc("/critics/alice-example/tv", func(w http.ResponseWriter, r *http.Request) {
+		serveFile(w, "alice-example_tv.html")
+	})
+	mux.HandleFunc("/napi/critics/alice-example/movies", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("after") != "c1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		serveFile(w, "alice-example_movies_c1.json")
+	})
+	mux.HandleFunc("/critics/adam-sample/movies", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func mustRead[T any](t *testing.T, filePath string) []T {
+	t.Helper()
+	structs, err := utils.ReadStructs[T](filePath, false)
+	if err != nil {
+		t.Fatalf("Can't read %s: %v", filePath, err)
+	}
+	return structs
+}
+
+func mustWrite[T fmt.Stringer](t *testing.T, structs []T, filePath string) {
+	t.Helper()
+	if _, err := utils.WriteStructs(context.Background(), structs, filePath, false); err != nil {
+		t.Fatalf("Can't write %s: %v", filePath, err)
+	}
+}
+
+func newTestFetcher(server *httptest.Server) (*Fetcher, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2023, 9, 17, 12, 0, 0, 0, time.UTC)}
+	f := NewFetcher(server.URL, server.Client(), clock)
+	f.retries = retryPolicy{maxRetries: 2, baseDelay: time.Second, maxDelay: time.Minute}
+	return f, clock
+}
+
+func TestFetchCritics(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	outFile := path.Join(t.TempDir(), "critics.gob")
+	f.fetch_critics(context.Background(), outFile)
+
+	critics := mustRead[Critic](t, outFile)
+	expected := []Critic{
+		{Name: "Alice Example", Url: "alice-example"},
+		{Name: "Adam Sample", Url: "adam-sample"},
+	}
+	if len(critics) != len(expected) {
+		t.Fatalf("Expected %d critics. Got %d", len(expected), len(critics))
+	}
+	for idx := range expected {
+		if critics[idx].Name != expected[idx].Name || critics[idx].Url != expected[idx].Url {
+			t.Errorf("Expected critic %v. Got %v", expected[idx], critics[idx])
+		}
+	}
+}
+
+func TestFetchReviews(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	reviews, err := f.fetch_reviews(context.Background(), &Critic{Url: "alice-example"}, []utils.MediaType{utils.MediaTypeMovie}, false)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	expectedUrls := []string{"/m/first_movie", "/m/second_movie", "/m/third_movie"}
+	if len(reviews) != len(expectedUrls) {
+		t.Fatalf("Expected %d reviews. Got %d", len(expectedUrls), len(reviews))
+	}
+	for idx, url := range expectedUrls {
+		if reviews[idx].MediaUrl != url {
+			t.Errorf("Expected review %d to be of %s. Got %s", idx, url, reviews[idx].MediaUrl)
+		}
+	}
+	if reviews[0].Score != "4/5" {
+		t.Errorf("Expected score '4/5'. Got '%s'", reviews[0].Score)
+	}
+
+	first := reviews[0]
+	if !first.Date.Equal(time.Date(2023, 9, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected date 2023-09-14. Got %v", first.Date)
+	}
+	if first.Publication != "Example Times" {
+		t.Errorf("Expected publication 'Example Times'. Got '%s'", first.Publication)
+	}
+	if first.Sentiment != utils.SentimentFresh {
+		t.Errorf("Expected fresh review. Got '%s'", first.Sentiment)
+	}
+	if first.Quote != "A moving drama." || first.ReviewUrl != "https://example.com/reviews/first-movie" {
+		t.Errorf("Expected quote and review link. Got '%s' and '%s'", first.Quote, first.ReviewUrl)
+	}
+	// no scoreSentiment -> falls back to isRotten
+	if reviews[1].Sentiment != utils.SentimentRotten {
+		t.Errorf("Expected rotten review. Got '%s'", reviews[1].Sentiment)
+	}
+	if !reviews[2].Date.IsZero() || reviews[2].Sentiment != "" {
+		t.Errorf("Expected no date and sentiment for review without them. Got %v", reviews[2])
+	}
+}
+
+func TestRetryOnTooManyRequests(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	f, clock := newTestFetcher(server)
+
+	body, err := f.sendRequest(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if string(body) != "ok" {
+		t.Errorf("Expected body 'ok'. Got '%s'", string(body))
+	}
+	if len(clock.slept) != 1 || clock.slept[0] != 30*time.Second {
+		t.Errorf("Expected to wait once for 30s. Waited %v", clock.slept)
+	}
+}
+
+func TestFetchAllReviews(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	outDir := path.Join(dir, "reviews")
+	mustWrite(t, []Critic{{Name: "Alice Example", Url: "alice-example"}, {Name: "Adam Sample", Url: "adam-sample"}}, criticsFile)
+
+	f.fetch_all_reviews(context.Background(), criticsFile, outDir, crawlOptions{workers: 2, mediaTypes: utils.MediaTypes})
+
+	reviews := mustRead[Review](t, path.Join(outDir, "alice-example.gob"))
+	if len(reviews) != 4 {
+		t.Fatalf("Expected 4 reviews of alice-example. Got %d", len(reviews))
+	}
+	if reviews[0].MediaType != utils.MediaTypeMovie {
+		t.Errorf("Expected first review to be a movie review. Got '%s'", reviews[0].MediaType)
+	}
+	if reviews[3].MediaType != utils.MediaTypeTv || reviews[3].MediaUrl != "/tv/some_show/s01" {
+		t.Errorf("Expected last review to be the TV review. Got %v", reviews[3])
+	}
+	if _, err := os.Stat(path.Join(outDir, "adam-sample.gob")); err == nil {
+		t.Errorf("Expected no reviews file for adam-sample")
+	}
+
+	states, err := readJournal(path.Join(outDir, JOURNAL_FILE))
+	if err != nil {
+		t.Fatalf("Can't read journal: %v", err)
+	}
+	if states["alice-example"] != stateDone {
+		t.Errorf("Expected alice-example to be done. Got '%s'", states["alice-example"])
+	}
+	if states["adam-sample"] != stateFailed {
+		t.Errorf("Expected adam-sample to have failed. Got '%s'", states["adam-sample"])
+	}
+
+	failures, err := readFailureReport(path.Join(outDir, FAILURES_FILE))
+	if err != nil {
+		t.Fatalf("Can't read failure report: %v", err)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("Expected 1 failure. Got %v", failures)
+	}
+	if failures[0].Url != "adam-sample" || failures[0].Kind != failureStatus || failures[0].StatusCode != 503 {
+		t.Errorf("Expected adam-sample to have failed with status 503. Got %v", failures[0])
+	}
+}
+
+func TestFetchAllReviewsUnwritableOutDir(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	mustWrite(t, []Critic{{Url: "alice-example"}}, criticsFile)
+
+	// the output directory can't be created where a file is
+	err := f.fetch_all_reviews(context.Background(), criticsFile, criticsFile, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes})
+	if err == nil || !strings.Contains(err.Error(), "output directory") {
+		t.Errorf("Expected an error about the output directory. Got %v", err)
+	}
+}
+
+func TestFetchAllReviewsResume(t *testing.T) {
+	base := newTestServer(t)
+	defer base.Close()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[strings.Split(strings.TrimPrefix(r.URL.Path, "/critics/"), "/")[0]]++
+		mu.Unlock()
+		base.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	outDir := path.Join(dir, "reviews")
+	mustWrite(t, []Critic{{Url: "alice-example"}, {Url: "adam-sample"}, {Url: "carl-nobody"}}, criticsFile)
+
+	// a crashed run that got through alice-example and adam-sample and was in the middle of carl-nobody
+	f.crawl_critics(context.Background(), []Critic{{Url: "alice-example"}, {Url: "adam-sample"}}, outDir, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes}, nil)
+	jrnl, err := openJournal(path.Join(outDir, JOURNAL_FILE), false)
+	if err != nil {
+		t.Fatalf("Can't open journal: %v", err)
+	}
+	jrnl.record("carl-nobody", stateInProgress, nil)
+	jrnl.Close()
+
+	mu.Lock()
+	requests = make(map[string]int)
+	mu.Unlock()
+	f.fetch_all_reviews(context.Background(), criticsFile, outDir, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes})
+
+	if requests["alice-example"] != 0 {
+		t.Errorf("Expected no requests for alice-example, which is done. Got %d", requests["alice-example"])
+	}
+	if requests["adam-sample"] == 0 {
+		t.Errorf("Expected the failed adam-sample to be fetched again")
+	}
+	if requests["carl-nobody"] == 0 {
+		t.Errorf("Expected carl-nobody, which was in progress, to be fetched again")
+	}
+	if reviews := mustRead[Review](t, path.Join(outDir, "alice-example.gob")); len(reviews) != 4 {
+		t.Errorf("Expected the reviews of alice-example to be kept. Got %d", len(reviews))
+	}
+}
+
+func TestFetchAllReviewsMediaTypeFailed(t *testing.T) {
+	base := newTestServer(t)
+	defer base.Close()
+	// the TV page keeps failing, but the movie reviews are fine
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/critics/alice-example/tv" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		base.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	outDir := path.Join(dir, "reviews")
+	mustWrite(t, []Critic{{Name: "Alice Example", Url: "alice-example"}}, criticsFile)
+
+	f.fetch_all_reviews(context.Background(), criticsFile, outDir, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes})
+
+	if reviews := mustRead[Review](t, path.Join(outDir, "alice-example.gob")); len(reviews) != 3 {
+		t.Errorf("Expected the 3 movie reviews to be kept. Got %d", len(reviews))
+	}
+	states, _ := readJournal(path.Join(outDir, JOURNAL_FILE))
+	if states["alice-example"] != stateIncomplete {
+		t.Errorf("Expected alice-example to be incomplete. Got '%s'", states["alice-example"])
+	}
+	failures, _ := readFailureReport(path.Join(outDir, FAILURES_FILE))
+	if len(failures) != 1 || failures[0].Kind != failureIncomplete || !strings.Contains(failures[0].Error, "tv reviews") {
+		t.Errorf("Expected alice-example to be incomplete because of the TV reviews. Got %v", failures)
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	outDir := t.TempDir()
+	err := writeFailureReport(path.Join(outDir, FAILURES_FILE), []failureEntry{
+		{Url: "alice-example", Kind: failureNetwork},
+		{Url: "bob-nobody", Kind: failureNoReviews},
+	})
+	if err != nil {
+		t.Fatalf("Can't write failure report: %v", err)
+	}
+
+	err = f.retry_failed(context.Background(), outDir, []failureKind{failureNetwork}, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes})
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	if reviews := mustRead[Review](t, path.Join(outDir, "alice-example.gob")); len(reviews) != 4 {
+		t.Errorf("Expected 4 reviews of alice-example. Got %d", len(reviews))
+	}
+	failures, err := readFailureReport(path.Join(outDir, FAILURES_FILE))
+	if err != nil {
+		t.Fatalf("Can't read failure report: %v", err)
+	}
+	if len(failures) != 1 || failures[0].Url != "bob-nobody" {
+		t.Errorf("Expected only the failure that wasn't retried to be left. Got %v", failures)
+	}
+	if info, err := os.Stat(path.Join(outDir, FAILURES_FILE)); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected the failure report to be readable by everyone. Got %v (%v)", info.Mode(), err)
+	}
+	if tmpFiles, _ := filepath.Glob(path.Join(outDir, "*.tmp")); len(tmpFiles) > 0 {
+		t.Errorf("Expected no temporary files to be left. Got %v", tmpFiles)
+	}
+}
+
+func TestRefreshReviews(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	outDir := t.TempDir()
+	fileName := path.Join(outDir, "alice-example.gob")
+	existing := []*Review{
+		{Score: "B+", MediaTitle: "Second Movie", MediaUrl: "/m/second_movie"},
+		{Score: "", MediaTitle: "Third Movie", MediaUrl: "/m/third_movie"},
+	}
+	mustWrite(t, existing, fileName)
+
+	// the second movie is on the first page -> the second page must not be needed
+	f.BaseURL = server.URL
+	requests := 0
+	f.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return server.Client().Transport.RoundTrip(req)
+	})}
+
+	if err := f.refresh_and_write(context.Background(), &Critic{Url: "alice-example"}, outDir, []utils.MediaType{utils.MediaTypeMovie}); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request. Got %d", requests)
+	}
+
+	reviews := mustRead[Review](t, fileName)
+	expectedUrls := []string{"/m/first_movie", "/m/second_movie", "/m/third_movie"}
+	if len(reviews) != len(expectedUrls) {
+		t.Fatalf("Expected %d reviews. Got %d", len(expectedUrls), len(reviews))
+	}
+	for idx, url := range expectedUrls {
+		if reviews[idx].MediaUrl != url {
+			t.Errorf("Expected review %d to be of %s. Got %s", idx, url, reviews[idx].MediaUrl)
+		}
+	}
+
+	// a corrupt file is replaced by fetching all reviews again
+	content, _ := os.ReadFile(fileName)
+	os.WriteFile(fileName, content[:len(content)-5], 0644)
+	if err := f.refresh_and_write(context.Background(), &Critic{Url: "alice-example"}, outDir, []utils.MediaType{utils.MediaTypeMovie}); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if reviews := mustRead[Review](t, fileName); len(reviews) != 3 {
+		t.Errorf("Expected all 3 movie reviews to be fetched again. Got %d", len(reviews))
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestFetchProfiles(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	criticsFile := path.Join(t.TempDir(), "critics.gob")
+	mustWrite(t, []Critic{{Name: "Alice Example", Url: "alice-example"}, {Name: "Adam Sample", Url: "adam-sample"}}, criticsFile)
+
+	f.fetch_profiles(context.Background(), criticsFile, criticsFile, 2, false)
+
+	critics := mustRead[Critic](t, criticsFile)
+	if len(critics) != 2 {
+		t.Fatalf("Expected 2 critics. Got %d", len(critics))
+	}
+
+	alice := critics[0]
+	expectedPublications := []string{"Example Times", "Films & Friends"}
+	if len(alice.Publications) != len(expectedPublications) {
+		t.Fatalf("Expected publications %v. Got %v", expectedPublications, alice.Publications)
+	}
+	for idx, publication := range expectedPublications {
+		if alice.Publications[idx] != publication {
+			t.Errorf("Expected publication '%s'. Got '%s'", publication, alice.Publications[idx])
+		}
+	}
+	if !alice.TopCritic || !alice.TomatometerApproved {
+		t.Errorf("Expected alice-example to be an approved top critic. Got %v", alice)
+	}
+	if alice.ReviewCount != 1234 {
+		t.Errorf("Expected 1234 reviews. Got %d", alice.ReviewCount)
+	}
+
+	// profile of adam-sample doesn't exist, but the critic is kept
+	if critics[1].Url != "adam-sample" || critics[1].TopCritic {
+		t.Errorf("Expected adam-sample without profile data. Got %v", critics[1])
+	}
+}
+
+func TestFetchMedia(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	mediaFile := path.Join(t.TempDir(), "movies.gob")
+	mustWrite(t, []utils.Media{
+		{MediaTitle: "First Movie", MediaInfo: "2023, Drama", MediaUrl: "/m/first_movie"},
+		{MediaTitle: "First Movie", MediaInfo: "2023, Drama", MediaUrl: "/m/first_movie"},
+		{MediaTitle: "Missing Movie", MediaInfo: "1999, Comedy", MediaUrl: "/m/missing_movie"},
+	}, mediaFile)
+
+	if err := f.fetch_all_media(context.Background(), mediaFile, mediaFile, 2, false); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	media := mustRead[utils.Media](t, mediaFile)
+	if len(media) != 2 {
+		t.Fatalf("Expected 2 distinct media. Got %d", len(media))
+	}
+
+	first := media[0]
+	if !first.MetadataFetched || first.ReleaseYear != 2023 || first.RuntimeMinutes != 180 || first.Rating != "R" {
+		t.Errorf("Expected year, runtime and rating of the first movie. Got %v", first)
+	}
+	if len(first.Genres) != 2 || first.Genres[0] != "Drama" || first.Genres[1] != "History" {
+		t.Errorf("Expected genres Drama and History. Got %v", first.Genres)
+	}
+	if first.TomatometerScore != 93 || first.AudienceScore != 91 {
+		t.Errorf("Expected scores 93 and 91. Got %d and %d", first.TomatometerScore, first.AudienceScore)
+	}
+
+	if media[1].MetadataFetched {
+		t.Errorf("Expected no metadata for a movie whose page doesn't exist. Got %v", media[1])
+	}
+}
+
+func TestParseRuntime(t *testing.T) {
+	cases := map[string]int{
+		"2h 15m":  135,
+		"45m":     45,
+		"PT1H30M": 90,
+		"PT2H":    120,
+		"":        0,
+	}
+	for raw, expected := range cases {
+		if actual := parseRuntime(raw); actual != expected {
+			t.Errorf("Expected %d minutes for '%s'. Got %d", expected, raw, actual)
+		}
+	}
+}
+
+func TestDiscoverCritics(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	criticsFile := path.Join(t.TempDir(), "critics.gob")
+	mustWrite(t, []Critic{{Name: "Alice Example", Url: "alice-example", TopCritic: true}}, criticsFile)
+
+	f.discover_critics(context.Background(), []string{"/m/first_movie"}, criticsFile, 5, 1, false)
+
+	critics := mustRead[Critic](t, criticsFile)
+	if len(critics) != 3 {
+		t.Fatalf("Expected 3 critics. Got %v", critics)
+	}
+	if !critics[0].TopCritic {
+		t.Errorf("Expected existing critic to be kept as is. Got %v", critics[0])
+	}
+	if critics[1].Url != "2nd-opinion" || critics[2].Name != "Zoë Zahl" {
+		t.Errorf("Expected the new critics to be appended. Got %v", critics[1:])
+	}
+}
+
+func TestFetchMovieCriticsPages(t *testing.T) {
+	// a movie with more review pages than the old default limit of 10
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page > 12 {
+			w.Write([]byte("<html><body></body></html>"))
+			return
+		}
+		fmt.Fprintf(w, `<a data-qa="review-critic-link" href="/critics/critic-%d">Critic %d</a>`, page, page)
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	critics, err := f.fetch_movie_critics(context.Background(), "/m/long_movie", 0)
+	if err != nil || len(critics) != 12 {
+		t.Errorf("Expected the critics of all 12 pages. Got %d (%v)", len(critics), err)
+	}
+	critics, err = f.fetch_movie_critics(context.Background(), "/m/long_movie", 3)
+	if err != nil || len(critics) != 3 {
+		t.Errorf("Expected the critics of the first 3 pages. Got %d (%v)", len(critics), err)
+	}
+}
+
+func TestFetchAllReviewsInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// simulates Ctrl+C while the first critic is fetched
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	outDir := path.Join(dir, "reviews")
+	mustWrite(t, []Critic{{Url: "alice-example"}, {Url: "adam-sample"}}, criticsFile)
+
+	f.fetch_all_reviews(ctx, criticsFile, outDir, crawlOptions{workers: 1, mediaTypes: utils.MediaTypes})
+
+	states, err := readJournal(path.Join(outDir, JOURNAL_FILE))
+	if err != nil {
+		t.Fatalf("Can't read journal: %v", err)
+	}
+	if states["alice-example"] != stateInProgress {
+		t.Errorf("Expected the interrupted critic to stay in progress. Got '%s'", states["alice-example"])
+	}
+	if _, ok := states["adam-sample"]; ok {
+		t.Errorf("Expected adam-sample not to be attempted. Got '%s'", states["adam-sample"])
+	}
+	if _, err := os.Stat(path.Join(outDir, "alice-example.gob")); err == nil {
+		t.Errorf("Expected no reviews file for the interrupted critic")
+	}
+}
@@ -0,0 +1,356 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/workqueue"
+)
+
+// Base URL of the site all the data is fetched from
+const DefaultBaseURL = "https://www.rottentomatoes.com"
+
+// Abstracts the passing of time, so that tests don't have to actually wait for backoffs and rate limits
+type Clock interface {
+	Now() time.Time
+	// Waits for d to pass. Returns early with the context's error if ctx is cancelled
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sends all requests of the fetch subcommands.
+// The base URL, HTTP client and clock are configurable, so the whole crawl can run against a test server.
+type Fetcher struct {
+	// URL without trailing slash all request paths are appended to
+	BaseURL string
+	Client  *http.Client
+	Clock   Clock
+
+	retries retryPolicy
+	// shared by all workers using this Fetcher
+	limiter *rateLimiter
+	// treat unknown fields in the reviews JSON as errors
+	strictSchema bool
+	// one of them is sent with each request
+	userAgents []string
+	// sent with every request
+	headers map[string]string
+	// reports the progress of the subcommands running many requests (nil for no reports)
+	progress workqueue.Reporter
+	// URLs it disallows aren't fetched (nil allows everything)
+	robots *robotsPolicy
+}
+
+// Creates a Fetcher with the default retry policy and no rate limit.
+// A nil client or clock is replaced by http.DefaultClient or the real clock respectively.
+func NewFetcher(baseURL string, client *http.Client, clock Clock) *Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &Fetcher{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Client:     client,
+		Clock:      clock,
+		retries:    defaultRetryPolicy,
+		userAgents: USER_AGENTS,
+	}
+}
+
+// Options shared by all fetch subcommands
+type requestOptions struct {
+	baseURL string
+	retries retryPolicy
+	rps     float64
+	burst   int
+	// directory to record all responses to
+	recordDir string
+	// directory to replay recorded responses from instead of using the network
+	replayDir    string
+	strictSchema bool
+	// JSON file with the ClientProfile to use
+	clientProfile string
+	// directory to archive all successful responses in (see archivingTransport)
+	archiveDir string
+	// creates the selected progress reporter
+	progress func() (workqueue.Reporter, error)
+	// local robots.txt to use instead of the one of the site
+	robotsFile   string
+	ignoreRobots bool
+}
+
+// Adds the flags controlling how requests are sent to the given flag set
+func addRequestFlags(set *flag.FlagSet) *requestOptions {
+	opts := &requestOptions{}
+	set.StringVar(&opts.baseURL, "base-url", DefaultBaseURL, "Base URL of the site to fetch from")
+	set.IntVar(&opts.retries.maxRetries, "retries", defaultRetryPolicy.maxRetries, "Number of times a failed request is retried")
+	set.DurationVar(&opts.retries.baseDelay, "backoff", defaultRetryPolicy.baseDelay, "Delay before the first retry (doubles with each retry)")
+	set.DurationVar(&opts.retries.maxDelay, "max-backoff", defaultRetryPolicy.maxDelay, "Maximum delay between two retries")
+	set.Float64Var(&opts.rps, "rps", 5, "Maximum number of requests per second shared by all workers (0 for no limit)")
+	set.IntVar(&opts.burst, "burst", 5, "Maximum number of requests that may be sent at once before the rate limit kicks in")
+	set.StringVar(&opts.recordDir, "record", "", "Directory to store every request URL and its raw response in")
+	set.BoolVar(&opts.strictSchema, "strict-schema", false, "Treat unknown fields in the reviews JSON as errors")
+	set.StringVar(&opts.clientProfile, "client-profile", "", "JSON file with the user agents, headers, cookies, proxy and timeouts to use (see README)")
+	set.StringVar(&opts.archiveDir, "archive", "", "Directory to archive the compressed body of every response in, so the reviews can be rebuilt with 'fetch reparse'")
+	set.StringVar(&opts.replayDir, "replay", "", "Directory with responses stored by -record to serve instead of going to the network")
+	set.StringVar(&opts.robotsFile, "robots", "", "Local robots.txt to honor instead of the one fetched from the site")
+	set.BoolVar(&opts.ignoreRobots, "ignore-robots", false, "Don't honor any robots.txt (only meant for local test servers)")
+	opts.progress = workqueue.AddFlag(set)
+	return opts
+}
+
+// Creates the Fetcher described by the options. Has to be called after the flags were parsed
+func (opts *requestOptions) newFetcher() (*Fetcher, error) {
+	if opts.recordDir != "" && opts.replayDir != "" {
+		return nil, fmt.Errorf("-record and -replay can't be used together")
+	}
+	if opts.archiveDir != "" && opts.replayDir != "" {
+		return nil, fmt.Errorf("-archive and -replay can't be used together")
+	}
+
+	profile := DefaultClientProfile()
+	if opts.clientProfile != "" {
+		var err error
+		profile, err = LoadClientProfile(opts.clientProfile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	client, err := profile.newClient(opts.baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewFetcher(opts.baseURL, client, nil)
+	f.retries = opts.retries
+	f.limiter = newRateLimiter(opts.rps, opts.burst, f.Clock)
+	f.strictSchema = opts.strictSchema
+	f.userAgents = profile.UserAgents
+	f.headers = profile.Headers
+	if opts.progress != nil {
+		f.progress, err = opts.progress()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.recordDir != "" {
+		transport, err := newRecordingTransport(opts.recordDir, client.Transport)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+	if opts.replayDir != "" {
+		transport, err := newReplayTransport(opts.replayDir)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+		// no need to be polite to the disk, and a recorded answer is the same every time
+		f.limiter = nil
+		f.retries = retryPolicy{}
+	}
+	if opts.archiveDir != "" {
+		transport, err := newArchivingTransport(opts.archiveDir, client.Transport)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+
+	if !opts.ignoreRobots {
+		if err := f.loadRobots(opts.robotsFile, opts.rps, opts.replayDir == ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Loads the robots.txt of the site (or the given local file) and honors it for all further requests.
+// If it asks for a crawl delay that is longer than the rate limit allows and limit is set, the rate limit is lowered accordingly.
+func (f *Fetcher) loadRobots(robotsFile string, rps float64, limit bool) error {
+	var policy *robotsPolicy
+	var err error
+	if robotsFile != "" {
+		var content []byte
+		content, err = os.ReadFile(robotsFile)
+		if err != nil {
+			return err
+		}
+		policy, err = parseRobots(content, ROBOTS_AGENT)
+	} else {
+		policy, err = f.fetchRobots(context.Background())
+	}
+	if err != nil {
+		return err
+	}
+	f.robots = policy
+
+	if limit && policy.crawlDelay > 0 {
+		delayRps := 1 / policy.crawlDelay.Seconds()
+		if rps <= 0 || delayRps < rps {
+			f.limiter = newRateLimiter(delayRps, 1, f.Clock)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Honoring robots.txt: %d rules; crawl delay %v\n", len(policy.rules), policy.crawlDelay)
+	return nil
+}
+
+// Fetches the robots.txt of the site. If there is none (4xx), everything is allowed.
+// If it can't be fetched for other reasons, an error is returned, as we don't know what we may fetch.
+func (f *Fetcher) fetchRobots(ctx context.Context) (*robotsPolicy, error) {
+	body, err := f.sendRequest(ctx, f.BaseURL+"/robots.txt")
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code >= 400 && statusErr.Code < 500 && statusErr.Code != http.StatusTooManyRequests {
+		return &robotsPolicy{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch robots.txt (use -robots or -ignore-robots to go on anyway): %w", err)
+	}
+	return parseRobots(body, ROBOTS_AGENT)
+}
+
+// Creates a Fetcher that answers all requests from the archive in archiveDir instead of the network.
+// baseURL has to be the one the archive was fetched from.
+func newArchiveFetcher(baseURL, archiveDir string, strictSchema bool) (*Fetcher, error) {
+	transport, err := newArchiveTransport(archiveDir)
+	if err != nil {
+		return nil, err
+	}
+	f := NewFetcher(baseURL, &http.Client{Transport: transport}, nil)
+	// the archive gives the same answer every time
+	f.retries = retryPolicy{}
+	f.strictSchema = strictSchema
+	return f, nil
+}
+
+// Sends a GET request to the given url and returns the body of the response.
+// Network errors, 429 and 5xx responses are retried according to the retry policy.
+// Cancelling ctx aborts the request as well as any backoff. URLs disallowed by robots.txt aren't fetched but return a *DisallowedError,
+// which also holds for redirects to them.
+func (f *Fetcher) sendRequest(ctx context.Context, url string) ([]byte, error) {
+	if !f.robots.allowed(url) {
+		return nil, &DisallowedError{Url: url}
+	}
+
+	var err error
+	for attempt := 0; attempt <= f.retries.maxRetries; attempt++ {
+		var body []byte
+		body, err = f.sendRequestOnce(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		var disallowedErr *DisallowedError
+		if ctx.Err() != nil || errors.As(err, &disallowedErr) {
+			return nil, err
+		}
+
+		var retryAfter time.Duration
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			if !statusErr.temporary() {
+				return nil, err
+			}
+			retryAfter = statusErr.RetryAfter
+		}
+
+		if attempt < f.retries.maxRetries {
+			if err := f.Clock.Sleep(ctx, f.retries.delay(attempt+1, retryAfter)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("giving up after %d retries: %w", f.retries.maxRetries, err)
+}
+
+// Returns the client to send requests with. Redirects are only followed to URLs robots.txt allows
+func (f *Fetcher) client() *http.Client {
+	if f.robots == nil {
+		return f.Client
+	}
+	// a copy shares the transport, so the connections are still reused
+	client := *f.Client
+	next := f.Client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !f.robots.allowed(req.URL.String()) {
+			return &DisallowedError{Url: req.URL.String()}
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		// the default policy of http.Client
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &client
+}
+
+func (f *Fetcher) sendRequestOnce(ctx context.Context, url string) ([]byte, error) {
+	if delay := f.limiter.reserve(f.Clock.Now()); delay > 0 {
+		if err := f.Clock.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range f.headers {
+		req.Header.Set(key, value)
+	}
+	// add some user agent because without some spam filters kick in
+	if len(f.userAgents) > 0 {
+		req.Header.Set("User-Agent", f.userAgents[rand.Intn(len(f.userAgents))])
+	}
+
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw_body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, &StatusError{
+			Code:       resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), f.Clock.Now()),
+		}
+	}
+
+	return raw_body, nil
+}
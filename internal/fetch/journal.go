@@ -0,0 +1,144 @@
+package fetch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Name of the journal file placed inside the reviews output directory
+const JOURNAL_FILE = "journal.jsonl"
+
+// Name of the journal of 'fetch reparse', which is kept apart from the one of the crawl
+const REPARSE_JOURNAL_FILE = "reparse-journal.jsonl"
+
+type criticState string
+
+const (
+	stateInProgress criticState = "in-progress"
+	stateDone       criticState = "done"
+	stateFailed     criticState = "failed"
+	// some of the reviews were written, but the pagination stopped early
+	stateIncomplete criticState = "incomplete"
+)
+
+type journalEntry struct {
+	Url   string
+	State criticState
+	Time  time.Time
+	Error string `json:",omitempty"`
+}
+
+// Append-only log of the state of every critic of a fetch_all_reviews run.
+// Every state change is written as one JSON line, so a crash loses at most the line that was being written.
+// When the journal is read again, the last entry of each critic wins.
+type journal struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	states map[string]criticState
+}
+
+// Opens (or creates) the journal fileName and reads the states recorded so far.
+// If fresh is set, the old journal is discarded.
+func openJournal(fileName string, fresh bool) (*journal, error) {
+	states := make(map[string]criticState)
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if fresh {
+		flags |= os.O_TRUNC
+	} else {
+		var err error
+		states, err = readJournal(fileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(fileName, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journal{
+		file:   file,
+		enc:    json.NewEncoder(file),
+		states: states,
+	}, nil
+}
+
+// Reads the last recorded state of each critic. A missing file is the same as an empty journal.
+func readJournal(fileName string) (map[string]criticState, error) {
+	states := make(map[string]criticState)
+
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// most likely the last line of a crashed run
+			fmt.Fprintf(os.Stderr, "Ignoring broken journal line: %v\n", err)
+			continue
+		}
+		states[entry.Url] = entry.State
+	}
+
+	return states, scanner.Err()
+}
+
+// Returns the last recorded state of the critic with the given URL (empty if there is none)
+func (j *journal) state(criticUrl string) criticState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.states[criticUrl]
+}
+
+// Records a new state for the critic with the given URL. err is stored as the reason if it is not nil.
+func (j *journal) record(criticUrl string, state criticState, err error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := journalEntry{
+		Url:   criticUrl,
+		State: state,
+		Time:  time.Now(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := j.enc.Encode(entry); err != nil {
+		return err
+	}
+	j.states[criticUrl] = state
+	return j.file.Sync()
+}
+
+// Counts how many critics are in the given state
+func (j *journal) count(state criticState) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	cnt := 0
+	for _, s := range j.states {
+		if s == state {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func (j *journal) Close() error {
+	return j.file.Close()
+}
@@ -0,0 +1,165 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+var (
+	audienceScoreRegExp    = regexp.MustCompile(`audiencescore="(\d+)"`)
+	tomatometerScoreRegExp = regexp.MustCompile(`tomatometerscore="(\d+)"`)
+	scoreBoardRatingRegExp = regexp.MustCompile(`<score-board[^>]* rating="([^"]*)"`)
+	subtitleRegExp         = regexp.MustCompile(`data-qa="score-panel-subtitle"[^>]*>([^<]*)<`)
+	runtimeRegExp          = regexp.MustCompile(`(?:(\d+)h)?\s*(\d+)m\b`)
+	isoDurationRegExp      = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?`)
+	yearRegExp             = regexp.MustCompile(`\b(1[89]\d\d|20\d\d)\b`)
+)
+
+type rawAggregateRating struct {
+	RatingValue json.Number
+}
+
+// The parts of the JSON-LD of a media page we're interested in
+type rawMediaLd struct {
+	DateCreated     string
+	Genre           json.RawMessage
+	ContentRating   string
+	Duration        string
+	AggregateRating *rawAggregateRating
+}
+
+// JSON-LD allows single values and lists for most fields
+func parseStringOrList(raw json.RawMessage) []string {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil && single != "" {
+		return []string{single}
+	}
+	return nil
+}
+
+// Parses a runtime like "2h 15m" or an ISO 8601 duration like "PT2H15M" into minutes. Returns 0 if it can't be parsed
+func parseRuntime(raw string) int {
+	match := isoDurationRegExp.FindStringSubmatch(raw)
+	if match == nil || (match[1] == "" && match[2] == "") {
+		match = runtimeRegExp.FindStringSubmatch(raw)
+	}
+	if match == nil {
+		return 0
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	return hours*60 + minutes
+}
+
+// Extracts the metadata of a medium from its page. mediaInfo (e.g. "2023, Drama") is used as a fallback for the release year
+func parseMediaMetadata(body, mediaInfo string) utils.MediaMetadata {
+	metadata := utils.MediaMetadata{
+		MetadataFetched:  true,
+		TomatometerScore: -1,
+		AudienceScore:    -1,
+	}
+
+	// structured data about the medium embedded in each media page
+	ldJson, found, _ := extractScript([]byte(body), func(attrs map[string]string) bool {
+		return attrs["type"] == "application/ld+json"
+	})
+	if found {
+		var ld rawMediaLd
+		if err := json.Unmarshal(ldJson, &ld); err == nil {
+			if year := yearRegExp.FindString(ld.DateCreated); year != "" {
+				metadata.ReleaseYear, _ = strconv.Atoi(year)
+			}
+			metadata.Genres = parseStringOrList(ld.Genre)
+			metadata.Rating = ld.ContentRating
+			metadata.RuntimeMinutes = parseRuntime(ld.Duration)
+			if ld.AggregateRating != nil {
+				if score, err := ld.AggregateRating.RatingValue.Float64(); err == nil {
+					metadata.TomatometerScore = int(score)
+				}
+			}
+		}
+	}
+
+	if match := tomatometerScoreRegExp.FindStringSubmatch(body); match != nil {
+		metadata.TomatometerScore, _ = strconv.Atoi(match[1])
+	}
+	if match := audienceScoreRegExp.FindStringSubmatch(body); match != nil {
+		metadata.AudienceScore, _ = strconv.Atoi(match[1])
+	}
+	if metadata.Rating == "" {
+		if match := scoreBoardRatingRegExp.FindStringSubmatch(body); match != nil {
+			metadata.Rating = match[1]
+		}
+	}
+	if metadata.RuntimeMinutes == 0 {
+		if match := subtitleRegExp.FindStringSubmatch(body); match != nil {
+			metadata.RuntimeMinutes = parseRuntime(match[1])
+		}
+	}
+	if metadata.ReleaseYear == 0 {
+		if year := yearRegExp.FindString(mediaInfo); year != "" {
+			metadata.ReleaseYear, _ = strconv.Atoi(year)
+		}
+	}
+
+	return metadata
+}
+
+// Returns the URL of the page of a medium
+func (f *Fetcher) mediaPageUrl(mediaUrl string) string {
+	if strings.HasPrefix(mediaUrl, "http://") || strings.HasPrefix(mediaUrl, "https://") {
+		return mediaUrl
+	}
+	return f.BaseURL + "/" + strings.TrimPrefix(mediaUrl, "/")
+}
+
+// Fetches the page of the given medium and fills in its metadata
+func (f *Fetcher) fetch_media_metadata(ctx context.Context, medium *utils.Media) error {
+	raw_body, err := f.sendRequest(ctx, f.mediaPageUrl(medium.MediaUrl))
+	if err != nil {
+		return err
+	}
+
+	medium.MediaMetadata = parseMediaMetadata(string(raw_body), medium.MediaInfo)
+	return nil
+}
+
+// Fetches the metadata of every distinct medium in mediaFile and writes the media including their metadata to outFile.
+// Media whose page can't be fetched are written without metadata.
+func (f *Fetcher) fetch_all_media(ctx context.Context, mediaFile, outFile string, workers int, verbose bool) error {
+	allMedia, err := utils.ReadStructs[utils.Media](mediaFile, verbose)
+	if err != nil {
+		return err
+	}
+	var media []utils.Media
+	seen := make(map[string]bool)
+	for _, medium := range allMedia {
+		if seen[medium.MediaUrl] {
+			continue
+		}
+		seen[medium.MediaUrl] = true
+		media = append(media, medium)
+	}
+
+	errs := f.runParallel(ctx, len(media), workers, "Fetching media", func(ctx context.Context, idx int) error {
+		if err := f.fetch_media_metadata(ctx, &media[idx]); err != nil {
+			return fmt.Errorf("%s: %w", media[idx].MediaUrl, err)
+		}
+		return nil
+	})
+	printErrors("Media whose page couldn't be fetched", errs)
+
+	// also store the metadata fetched before an interruption
+	_, err = utils.WriteStructs(context.Background(), media, outFile, false)
+	return err
+}
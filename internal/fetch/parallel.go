@@ -0,0 +1,31 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/MamfTheKramf/critics_finder/internal/workqueue"
+)
+
+// Calls job for every index in [0; count) using the given number of workers and reports the progress under label.
+// Returns the errors of all failed jobs.
+func (f *Fetcher) runParallel(ctx context.Context, count, workers int, label string, job func(ctx context.Context, idx int) error) []error {
+	_, errs := workqueue.Run(ctx, count, workqueue.Options{
+		Workers:  workers,
+		Label:    label,
+		Reporter: f.progress,
+	}, job)
+	return errs
+}
+
+// Prints the given errors below the header (if there are any)
+func printErrors(header string, errs []error) {
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, header)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
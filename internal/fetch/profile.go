@@ -0,0 +1,121 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+	"golang.org/x/net/html"
+)
+
+var approvedRegExp = regexp.MustCompile(`(?i)tomatometer[- ]approved`)
+
+// Fills the profile fields of critic with the information in the header of its profile page.
+// The rest of the page (navigation, footer, ...) is ignored, since it may mention the same phrases for every critic.
+// Returns a *PageStructureError if the page has no profile header.
+func parseCriticProfile(body []byte, critic *Critic) error {
+	found := false
+	err := forEachTag(body, "div", func(z *html.Tokenizer, attrs map[string]string) {
+		if found || !hasClass(attrs, "critic-header") {
+			return
+		}
+		found = true
+		parseProfileHeader(z, critic)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return &PageStructureError{Missing: `the profile header (<div class="critic-header">)`}
+	}
+	return nil
+}
+
+// Reads the profile header whose start tag the tokenizer is currently at
+func parseProfileHeader(z *html.Tokenizer, critic *Critic) {
+	critic.Publications = nil
+	critic.TopCritic = false
+	critic.ReviewCount = 0
+	seen := make(map[string]bool)
+	var text strings.Builder
+
+	depth := 1
+	for depth > 0 {
+		tokenType := z.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			depth = 0
+		case html.TextToken:
+			text.Write(z.Text())
+			text.WriteString(" ")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			attrs := map[string]string{}
+			if hasAttr {
+				attrs = readAttrs(z)
+			}
+
+			switch qa := attrs["data-qa"]; {
+			case qa == "critic-publication-link":
+				if publication := readText(z, tag); publication != "" && !seen[publication] {
+					seen[publication] = true
+					critic.Publications = append(critic.Publications, publication)
+				}
+				continue
+			case qa == "critic-review-count":
+				digits := strings.NewReplacer(",", "", ".", "").Replace(readText(z, tag))
+				if count, err := strconv.Atoi(digits); err == nil {
+					critic.ReviewCount = count
+				}
+				continue
+			case strings.HasPrefix(qa, "critic-top-critic"):
+				critic.TopCritic = true
+			}
+			if tag == "div" && tokenType == html.StartTagToken {
+				depth++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "div" {
+				depth--
+			}
+		}
+	}
+
+	critic.TomatometerApproved = approvedRegExp.MatchString(text.String())
+}
+
+// Fetches the profile page of the given critic and fills in its profile fields
+func (f *Fetcher) fetch_profile(ctx context.Context, critic *Critic) error {
+	const url = "%s/critics/%s"
+	raw_body, err := f.sendRequest(ctx, fmt.Sprintf(url, f.BaseURL, critic.Url))
+	if err != nil {
+		return err
+	}
+
+	return parseCriticProfile(raw_body, critic)
+}
+
+// Fetches the profiles of all critics in criticsFile and writes the critics including their profile data to outFile.
+// Critics whose profile can't be fetched are written without profile data.
+func (f *Fetcher) fetch_profiles(ctx context.Context, criticsFile, outFile string, workers int, verbose bool) error {
+	critics, err := utils.ReadStructs[Critic](criticsFile, verbose)
+	if err != nil {
+		return err
+	}
+
+	errs := f.runParallel(ctx, len(critics), workers, "Fetching profiles", func(ctx context.Context, idx int) error {
+		if err := f.fetch_profile(ctx, &critics[idx]); err != nil {
+			return fmt.Errorf("%s: %w", critics[idx].Url, err)
+		}
+		return nil
+	})
+	printErrors("Critics whose profile couldn't be fetched", errs)
+
+	// also store the profiles fetched before an interruption
+	_, err = utils.WriteStructs(context.Background(), critics, outFile, false)
+	return err
+}
@@ -0,0 +1,60 @@
+package fetch
+
+import (
+	"sync"
+	"time"
+)
+
+// Token bucket that is shared by all workers, so that the total number of requests per second stays bounded
+// no matter how many workers there are.
+// A nil *rateLimiter doesn't limit anything.
+type rateLimiter struct {
+	mu sync.Mutex
+	// tokens added per second
+	rate float64
+	// maximum number of tokens in the bucket
+	burst float64
+	// can become negative when requests are already waiting for tokens
+	tokens float64
+	last   time.Time
+}
+
+// Creates a limiter allowing rps requests per second with bursts of up to burst requests.
+// clock has to be the one the times passed to reserve come from. Returns nil (no limit) if rps isn't positive.
+func newRateLimiter(rps float64, burst int, clock Clock) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// Takes a token from the bucket. Returns how long the caller has to wait before it may send its request.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
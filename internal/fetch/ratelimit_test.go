@@ -0,0 +1,47 @@
+package fetch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	// far away from the wall clock, so the limiter must only use the given clock
+	start := time.Date(2023, 9, 17, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2, 3, &fakeClock{now: start})
+
+	for i := 0; i < 3; i++ {
+		if delay := limiter.reserve(start); delay != 0 {
+			t.Errorf("Expected request %d of the burst to pass immediately. Got delay %v", i, delay)
+		}
+	}
+
+	// bucket is empty now -> each further request has to wait another half second
+	if delay := limiter.reserve(start); delay != 500*time.Millisecond {
+		t.Errorf("Expected delay of 500ms. Got %v", delay)
+	}
+	if delay := limiter.reserve(start); delay != time.Second {
+		t.Errorf("Expected delay of 1s. Got %v", delay)
+	}
+
+	// after 10 seconds the bucket is full again, but not fuller than burst
+	later := start.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		if delay := limiter.reserve(later); delay != 0 {
+			t.Errorf("Expected request %d after refill to pass immediately. Got delay %v", i, delay)
+		}
+	}
+	if delay := limiter.reserve(later); delay == 0 {
+		t.Errorf("Expected bucket to be capped at the burst size")
+	}
+}
+
+func TestNoRateLimit(t *testing.T) {
+	limiter := newRateLimiter(0, 10, realClock{})
+	if limiter != nil {
+		t.Fatalf("Expected no limiter for a rate of 0")
+	}
+	if delay := limiter.reserve(time.Now()); delay != 0 {
+		t.Errorf("Expected nil limiter to never wait. Got %v", delay)
+	}
+}
@@ -0,0 +1,131 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+)
+
+// Information about a recorded response that is stored next to its body
+type recordedMeta struct {
+	Url        string
+	StatusCode int
+	Header     http.Header
+}
+
+// Returns the file name (without extension) under which the response to url is stored
+func recordKey(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(hash[:])
+}
+
+// http.RoundTripper that passes requests on to next and stores every response in dir.
+// For each request, the raw body is written to <key>.body and the URL and status to <key>.json.
+// A later response for the same URL overwrites the earlier one.
+type recordingTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func newRecordingTransport(dir string, next http.RoundTripper) (*recordingTransport, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordingTransport{dir: dir, next: next}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := req.URL.String()
+	key := recordKey(url)
+	meta, err := json.MarshalIndent(recordedMeta{Url: url, StatusCode: resp.StatusCode, Header: resp.Header}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path.Join(t.dir, key+".body"), body, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path.Join(t.dir, key+".json"), meta, 0644); err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// http.RoundTripper that never touches the network but answers with the responses recorded in dir.
+// Requests that weren't recorded are answered with 404.
+type replayTransport struct {
+	dir string
+}
+
+func newReplayTransport(dir string) (*replayTransport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &replayTransport{dir: dir}, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	key := recordKey(url)
+
+	rawMeta, err := os.ReadFile(path.Join(t.dir, key+".json"))
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "No recorded response for %s\n", url)
+		return &http.Response{
+			Status:     "404 Not Found",
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{},
+			Body:       io.NopCloser(bytes.NewReader(nil)),
+			Request:    req,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta recordedMeta
+	if err := json.Unmarshal(rawMeta, &meta); err != nil {
+		return nil, fmt.Errorf("broken recording for %s: %w", url, err)
+	}
+	body, err := os.ReadFile(path.Join(t.dir, key+".body"))
+	if err != nil {
+		return nil, err
+	}
+	if meta.Header == nil {
+		meta.Header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", meta.StatusCode, http.StatusText(meta.StatusCode)),
+		StatusCode:    meta.StatusCode,
+		Header:        meta.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server := newTestServer(t)
+	dir := t.TempDir()
+
+	recorder, err := newRecordingTransport(dir, server.Client().Transport)
+	if err != nil {
+		t.Fatalf("Can't create recorder: %v", err)
+	}
+	f, _ := newTestFetcher(server)
+	f.Client = &http.Client{Transport: recorder}
+
+	recorded, err := f.fetch_reviews(context.Background(), &Critic{Url: "alice-example"}, []utils.MediaType{utils.MediaTypeMovie}, false)
+	if err != nil {
+		t.Fatalf("Expected no error while recording. Got %v", err)
+	}
+
+	// the server is gone, so everything has to come from the recording
+	server.Close()
+
+	replayer, err := newReplayTransport(dir)
+	if err != nil {
+		t.Fatalf("Can't create replayer: %v", err)
+	}
+	f.Client = &http.Client{Transport: replayer}
+
+	replayed, err := f.fetch_reviews(context.Background(), &Critic{Url: "alice-example"}, []utils.MediaType{utils.MediaTypeMovie}, false)
+	if err != nil {
+		t.Fatalf("Expected no error while replaying. Got %v", err)
+	}
+	if len(replayed) != len(recorded) {
+		t.Fatalf("Expected %d replayed reviews. Got %d", len(recorded), len(replayed))
+	}
+	for idx := range recorded {
+		if *replayed[idx] != *recorded[idx] {
+			t.Errorf("Expected replayed review %v. Got %v", *recorded[idx], *replayed[idx])
+		}
+	}
+
+	_, err = f.sendRequest(context.Background(), f.BaseURL+"/never/recorded")
+	statusErr, ok := err.(*StatusError)
+	if !ok || statusErr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a request that wasn't recorded. Got %v", err)
+	}
+}
+
+func TestReplayDoesNotRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	dir := t.TempDir()
+	recorder, err := newRecordingTransport(dir, server.Client().Transport)
+	if err != nil {
+		t.Fatalf("Can't create recorder: %v", err)
+	}
+	f, _ := newTestFetcher(server)
+	f.retries = retryPolicy{}
+	f.Client = &http.Client{Transport: recorder}
+	if _, err := f.sendRequest(context.Background(), server.URL+"/critics/adam-sample/movies"); err == nil {
+		t.Fatalf("Expected the 503 to be recorded as an error")
+	}
+	server.Close()
+
+	opts := requestOptions{baseURL: server.URL, retries: defaultRetryPolicy, replayDir: dir, ignoreRobots: true}
+	f, err = opts.newFetcher()
+	if err != nil {
+		t.Fatalf("Can't create replaying fetcher: %v", err)
+	}
+	clock := &fakeClock{}
+	f.Clock = clock
+	attempts := 0
+	replayer := f.Client.Transport
+	f.Client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return replayer.RoundTrip(req)
+	})
+
+	_, err = f.sendRequest(context.Background(), server.URL+"/critics/adam-sample/movies")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the recorded 503. Got %v", err)
+	}
+	if attempts != 1 || len(clock.slept) != 0 {
+		t.Errorf("Expected exactly one attempt without backoff. Got %d attempts, slept %v", attempts, clock.slept)
+	}
+}
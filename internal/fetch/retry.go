@@ -0,0 +1,107 @@
+package fetch
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Error returned by sendRequest if the server answered with a status code other than 200
+type StatusError struct {
+	Code int
+	// How long the server asked us to wait before trying again (0 if it didn't say)
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("got bad status code %d", e.Code)
+}
+
+// Returns whether it makes sense to send the same request again
+func (e *StatusError) temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// Error returned by fetch_reviews if the pagination stopped before the last page was reached
+// or the reviews of one of the media types couldn't be fetched at all.
+// The reviews that were fetched until then are still returned.
+type IncompleteError struct {
+	// Media type whose reviews are incomplete (empty if there's only one kind of pages)
+	MediaType utils.MediaType
+	// Number of pages of MediaType that were fetched
+	Pages int
+	Err   error
+}
+
+func (e *IncompleteError) Error() string {
+	if e.MediaType != "" {
+		return fmt.Sprintf("%s reviews stopped after %d pages: %v", e.MediaType, e.Pages, e.Err)
+	}
+	return fmt.Sprintf("stopped after %d pages: %v", e.Pages, e.Err)
+}
+
+func (e *IncompleteError) Unwrap() error {
+	return e.Err
+}
+
+// Describes how often and how long to wait before a failed request is sent again
+type retryPolicy struct {
+	// Number of retries after the first attempt
+	maxRetries int
+	// Delay before the first retry. Doubles with every further retry
+	baseDelay time.Duration
+	// Upper bound for the delay between two attempts
+	maxDelay time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxRetries: 5,
+	baseDelay:  time.Second,
+	maxDelay:   2 * time.Minute,
+}
+
+// Returns how long to wait before the given retry (starting at 1).
+// Uses exponential backoff with jitter, but waits at least as long as the server asked for.
+// A Retry-After longer than maxDelay is cut down to it, so a worker isn't parked for hours.
+func (p retryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	backoff := p.baseDelay << (retry - 1)
+	if backoff > p.maxDelay || backoff <= 0 {
+		backoff = p.maxDelay
+	}
+	// jitter so that the workers don't all come back at the same time
+	if backoff > 1 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	if retryAfter > p.maxDelay {
+		retryAfter = p.maxDelay
+	}
+	if retryAfter > backoff {
+		return retryAfter
+	}
+	return backoff
+}
+
+// Parses the value of a Retry-After header. It can either be a number of seconds or an HTTP date.
+// Returns 0 if the header is empty or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
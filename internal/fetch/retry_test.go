@@ -0,0 +1,57 @@
+package fetch
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 9, 17, 12, 0, 0, 0, time.UTC)
+
+	cases := map[string]time.Duration{
+		"":     0,
+		"120":  2 * time.Minute,
+		"-3":   0,
+		"soon": 0,
+		now.Add(time.Minute).Format(http.TimeFormat):  time.Minute,
+		now.Add(-time.Minute).Format(http.TimeFormat): 0,
+	}
+
+	for header, expected := range cases {
+		actual := parseRetryAfter(header, now)
+		if actual != expected {
+			t.Errorf("Expected %v for Retry-After '%s'. Got %v", expected, header, actual)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := retryPolicy{
+		maxRetries: 5,
+		baseDelay:  time.Second,
+		maxDelay:   10 * time.Second,
+	}
+
+	for retry := 1; retry <= 5; retry++ {
+		upper := time.Second << (retry - 1)
+		if upper > policy.maxDelay {
+			upper = policy.maxDelay
+		}
+		delay := policy.delay(retry, 0)
+		if delay < upper/2 || delay > upper {
+			t.Errorf("Expected delay of retry %d to be within [%v; %v]. Got %v", retry, upper/2, upper, delay)
+		}
+	}
+
+	delay := policy.delay(1, 5*time.Second)
+	if delay != 5*time.Second {
+		t.Errorf("Expected Retry-After to win. Got %v", delay)
+	}
+
+	// a day (or a date far in the future) is capped at the maximum delay
+	delay = policy.delay(1, 24*time.Hour)
+	if delay != policy.maxDelay {
+		t.Errorf("Expected Retry-After to be capped at %v. Got %v", policy.maxDelay, delay)
+	}
+}
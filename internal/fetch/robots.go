@@ -0,0 +1,177 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name the crawler looks for in the User-agent lines of robots.txt
+const ROBOTS_AGENT = "critics_finder"
+
+// Error returned by sendRequest for URLs that robots.txt doesn't allow us to fetch
+type DisallowedError struct {
+	Url string
+}
+
+func (e *DisallowedError) Error() string {
+	return fmt.Sprintf("%s is disallowed by robots.txt", e.Url)
+}
+
+// One Allow or Disallow line
+type robotsRule struct {
+	allow bool
+	// the path pattern as written in robots.txt, used to find the most specific rule
+	pattern string
+	regex   *regexp.Regexp
+}
+
+// The rules of robots.txt that apply to us
+type robotsPolicy struct {
+	rules []robotsRule
+	// 0 if robots.txt doesn't ask for one
+	crawlDelay time.Duration
+}
+
+// Turns a robots.txt path pattern into a regex. "*" matches any sequence of characters and a trailing "$" anchors the pattern at the end
+func compileRobotsPattern(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for idx, part := range parts {
+		parts[idx] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.Compile(expr)
+}
+
+// A group of rules together with the user agents it applies to
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// Parses robots.txt and keeps the rules of the groups for agent.
+// If there is no group naming agent, the rules of the "*" group apply.
+// Rules of several matching groups are combined.
+func parseRobots(content []byte, agent string) (*robotsPolicy, error) {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	// a User-agent line directly after another one belongs to the same group
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !lastWasAgent || current == nil {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		}
+		lastWasAgent = false
+		// rules before the first User-agent line don't belong to anybody
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "allow", "disallow":
+			// an empty Disallow allows everything
+			if value == "" {
+				continue
+			}
+			regex, err := compileRobotsPattern(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid robots.txt pattern '%s': %w", value, err)
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value, regex: regex})
+		case "crawl-delay":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	matches := func(name string) []*robotsGroup {
+		var res []*robotsGroup
+		for _, group := range groups {
+			for _, groupAgent := range group.agents {
+				if groupAgent == name {
+					res = append(res, group)
+					break
+				}
+			}
+		}
+		return res
+	}
+	selected := matches(strings.ToLower(agent))
+	if len(selected) == 0 {
+		selected = matches("*")
+	}
+
+	policy := &robotsPolicy{}
+	for _, group := range selected {
+		policy.rules = append(policy.rules, group.rules...)
+		if group.crawlDelay > policy.crawlDelay {
+			policy.crawlDelay = group.crawlDelay
+		}
+	}
+	return policy, nil
+}
+
+// Returns whether the given URL may be fetched.
+// The most specific (longest) matching rule wins; if an Allow and a Disallow rule are equally specific, Allow wins.
+// A nil *robotsPolicy allows everything.
+func (p *robotsPolicy) allowed(rawUrl string) bool {
+	if p == nil {
+		return true
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	target := parsed.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if parsed.RawQuery != "" {
+		target += "?" + parsed.RawQuery
+	}
+
+	var best *robotsRule
+	for idx := range p.rules {
+		rule := &p.rules[idx]
+		if !rule.regex.MatchString(target) {
+			continue
+		}
+		if best == nil || len(rule.pattern) > len(best.pattern) || (len(rule.pattern) == len(best.pattern) && rule.allow) {
+			best = rule
+		}
+	}
+	return best == nil || best.allow
+}
@@ -0,0 +1,142 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	content := []byte(`# robots.txt of some site
+User-agent: *
+Disallow: /napi/
+Allow: /napi/public/
+Disallow: /*.json$
+Crawl-delay: 2
+
+User-agent: other-bot
+User-agent: critics_finder
+Disallow: /search
+Crawl-delay: 0.5
+`)
+
+	policy, err := parseRobots(content, "some-bot")
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	tests := map[string]bool{
+		"https://example.com/critics/jane-doe":         true,
+		"https://example.com/napi/critics/jane-doe":    false,
+		"https://example.com/napi/public/critics":      true,
+		"https://example.com/m/some_movie/data.json":   false,
+		"https://example.com/m/some_movie/data.json?x": true,
+	}
+	for url, expected := range tests {
+		if actual := policy.allowed(url); actual != expected {
+			t.Errorf("Expected allowed(%s) to be %v. Got %v", url, expected, actual)
+		}
+	}
+	if policy.crawlDelay != 2*time.Second {
+		t.Errorf("Expected crawl delay of 2s. Got %v", policy.crawlDelay)
+	}
+
+	// the group naming us replaces the "*" group
+	policy, err = parseRobots(content, ROBOTS_AGENT)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if !policy.allowed("https://example.com/napi/critics/jane-doe") || policy.allowed("https://example.com/search?q=x") {
+		t.Errorf("Expected the rules of the critics_finder group. Got %v", policy.rules)
+	}
+	if policy.crawlDelay != 500*time.Millisecond {
+		t.Errorf("Expected crawl delay of 500ms. Got %v", policy.crawlDelay)
+	}
+}
+
+func TestSendRequestHonorsRobots(t *testing.T) {
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested[r.URL.Path] = true
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\nCrawl-delay: 10\n"))
+		}
+	}))
+	defer server.Close()
+
+	opts := requestOptions{baseURL: server.URL, rps: 5, burst: 5}
+	f, err := opts.newFetcher()
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	_, err = f.sendRequest(context.Background(), server.URL+"/private/page")
+	var disallowedErr *DisallowedError
+	if !errors.As(err, &disallowedErr) {
+		t.Errorf("Expected DisallowedError. Got %v", err)
+	}
+	if requested["/private/page"] {
+		t.Errorf("Expected disallowed page not to be requested")
+	}
+	if f.limiter == nil || f.limiter.rate != 0.1 {
+		t.Errorf("Expected the crawl delay to lower the rate limit to 0.1 requests per second. Got %+v", f.limiter)
+	}
+	if kind := newFailureEntry(Critic{Url: "private"}, err).Kind; kind != failureDisallowed {
+		t.Errorf("Expected failure kind '%s'. Got '%s'", failureDisallowed, kind)
+	}
+}
+
+func TestRedirectHonorsRobots(t *testing.T) {
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested[r.URL.Path] = true
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/moved":
+			http.Redirect(w, r, "/private/page", http.StatusFound)
+		case "/also-moved":
+			http.Redirect(w, r, "/public/page", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+	if err := f.loadRobots("", 5, true); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+
+	_, err := f.sendRequest(context.Background(), server.URL+"/moved")
+	var disallowedErr *DisallowedError
+	if !errors.As(err, &disallowedErr) {
+		t.Errorf("Expected DisallowedError. Got %v", err)
+	}
+	if requested["/private/page"] {
+		t.Errorf("Expected the redirect to the disallowed page not to be followed")
+	}
+	if kind := newFailureEntry(Critic{Url: "moved"}, err).Kind; kind != failureDisallowed {
+		t.Errorf("Expected failure kind '%s'. Got '%s'", failureDisallowed, kind)
+	}
+
+	if _, err := f.sendRequest(context.Background(), server.URL+"/also-moved"); err != nil || !requested["/public/page"] {
+		t.Errorf("Expected redirects to allowed pages to be followed. Got %v", err)
+	}
+}
+
+func TestMissingRobotsAllowsEverything(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	if err := f.loadRobots("", 5, true); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if _, err := f.sendRequest(context.Background(), server.URL+"/anything"); err != nil {
+		t.Errorf("Expected everything to be allowed. Got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package fetch
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Returns the group of a critic when sampling stratified by first letter.
+// Everything that doesn't start with a letter ends up in the group "#"
+func firstLetter(critic Critic) string {
+	name := strings.TrimSpace(critic.Name)
+	if name == "" {
+		name = critic.Url
+	}
+	for _, r := range name {
+		if unicode.IsLetter(r) {
+			return string(unicode.ToLower(r))
+		}
+		break
+	}
+	return "#"
+}
+
+// Picks n random critics. The same seed always picks the same critics from the same list.
+// With stratify, each first letter gets a share of the sample proportional to its share of all critics.
+// The picked critics keep the order they have in critics. If n isn't smaller than the number of critics, all are returned.
+func sampleCritics(critics []Critic, n int, seed int64, stratify bool) []Critic {
+	if n <= 0 || n >= len(critics) {
+		return critics
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	picked := make([]bool, len(critics))
+	if !stratify {
+		for _, idx := range rng.Perm(len(critics))[:n] {
+			picked[idx] = true
+		}
+	} else {
+		groups := make(map[string][]int)
+		var letters []string
+		for idx, critic := range critics {
+			letter := firstLetter(critic)
+			if _, ok := groups[letter]; !ok {
+				letters = append(letters, letter)
+			}
+			groups[letter] = append(groups[letter], idx)
+		}
+		sort.Strings(letters)
+
+		// largest remainder method, so the shares add up to n
+		shares := make(map[string]int)
+		remainders := make(map[string]float64)
+		assigned := 0
+		for _, letter := range letters {
+			exact := float64(n) * float64(len(groups[letter])) / float64(len(critics))
+			shares[letter] = int(exact)
+			remainders[letter] = exact - float64(int(exact))
+			assigned += shares[letter]
+		}
+		byRemainder := append([]string{}, letters...)
+		sort.SliceStable(byRemainder, func(i, j int) bool {
+			return remainders[byRemainder[i]] > remainders[byRemainder[j]]
+		})
+		for i := 0; assigned < n; i++ {
+			shares[byRemainder[i]]++
+			assigned++
+		}
+
+		for _, letter := range letters {
+			group := groups[letter]
+			for _, pos := range rng.Perm(len(group))[:shares[letter]] {
+				picked[group[pos]] = true
+			}
+		}
+	}
+
+	var sample []Critic
+	for idx, critic := range critics {
+		if picked[idx] {
+			sample = append(sample, critic)
+		}
+	}
+	return sample
+}
@@ -0,0 +1,50 @@
+package fetch
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func generateCritics(prefix string, count int) []Critic {
+	var critics []Critic
+	for i := 0; i < count; i++ {
+		critics = append(critics, Critic{Name: fmt.Sprintf("%s %d", prefix, i), Url: fmt.Sprintf("%s-%d", prefix, i)})
+	}
+	return critics
+}
+
+func TestSampleCriticsReproducible(t *testing.T) {
+	critics := generateCritics("critic", 100)
+
+	first := sampleCritics(critics, 10, 42, false)
+	second := sampleCritics(critics, 10, 42, false)
+	if len(first) != 10 {
+		t.Fatalf("Expected 10 critics. Got %d", len(first))
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same seed to pick the same critics. Got %v and %v", first, second)
+	}
+	if reflect.DeepEqual(first, sampleCritics(critics, 10, 43, false)) {
+		t.Errorf("Expected another seed to pick other critics")
+	}
+	if len(sampleCritics(critics, 200, 42, false)) != 100 {
+		t.Errorf("Expected all critics if the sample is larger than the critics file")
+	}
+}
+
+func TestSampleCriticsStratified(t *testing.T) {
+	critics := append(generateCritics("Alice", 30), generateCritics("bob", 10)...)
+	critics = append(critics, generateCritics("2nd", 5)...)
+
+	sample := sampleCritics(critics, 9, 7, true)
+
+	counts := make(map[string]int)
+	for _, critic := range sample {
+		counts[firstLetter(critic)]++
+	}
+	expected := map[string]int{"a": 6, "b": 2, "#": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected %v critics per letter. Got %v", expected, counts)
+	}
+}
@@ -0,0 +1,167 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Error returned when a reviews JSON doesn't have the shape described by rawResp.
+// Fields are given as paths like "reviews[].mediaUrl".
+type SchemaError struct {
+	// Fields that are marked as required but are missing
+	Missing []string
+	// Fields we don't know. Only make the JSON invalid in strict mode
+	Unknown []string
+	// Values that have the wrong type
+	Invalid []string
+}
+
+func (e *SchemaError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing fields: %s", strings.Join(e.Missing, ", ")))
+	}
+	if len(e.Unknown) > 0 {
+		parts = append(parts, fmt.Sprintf("unknown fields: %s", strings.Join(e.Unknown, ", ")))
+	}
+	if len(e.Invalid) > 0 {
+		parts = append(parts, fmt.Sprintf("invalid values: %s", strings.Join(e.Invalid, ", ")))
+	}
+	return fmt.Sprintf("reviews JSON schema changed (%s)", strings.Join(parts, "; "))
+}
+
+// Collects the problems found while validating a JSON. Using sets avoids reporting the same field once per review
+type schemaReport struct {
+	missing map[string]bool
+	unknown map[string]bool
+	invalid map[string]bool
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the name of a struct field the way it's written in the JSON ("EndCursor" -> "endCursor")
+func jsonFieldName(field reflect.StructField) string {
+	if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag != "" {
+		return tag
+	}
+	return strings.ToLower(field.Name[:1]) + field.Name[1:]
+}
+
+// Checks that raw is an object matching the struct type typ.
+// Fields tagged with `schema:"required"` have to be present. Nested structs and slices of structs are checked as well.
+func (r *schemaReport) validateObject(raw json.RawMessage, typ reflect.Type, path string) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		r.invalid[strings.TrimSuffix(path, ".")+" (expected object)"] = true
+		return
+	}
+
+	matched := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := jsonFieldName(field)
+
+		// encoding/json matches field names case-insensitively, so we do the same
+		var value json.RawMessage
+		found := false
+		for key, val := range obj {
+			if strings.EqualFold(key, name) {
+				matched[key] = true
+				value = val
+				found = true
+			}
+		}
+		if !found {
+			if field.Tag.Get("schema") == "required" {
+				r.missing[path+name] = true
+			}
+			continue
+		}
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			r.validateObject(value, field.Type, path+name+".")
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			var elems []json.RawMessage
+			if err := json.Unmarshal(value, &elems); err != nil {
+				r.invalid[path+name+" (expected list)"] = true
+				continue
+			}
+			for _, elem := range elems {
+				r.validateObject(elem, field.Type.Elem(), path+name+"[].")
+			}
+		default:
+			// let encoding/json decide whether the value fits the field
+			if string(value) != "null" {
+				if err := json.Unmarshal(value, reflect.New(field.Type).Interface()); err != nil {
+					r.invalid[fmt.Sprintf("%s%s (expected %s)", path, name, field.Type.Kind())] = true
+				}
+			}
+		}
+	}
+
+	for key := range obj {
+		if !matched[key] {
+			r.unknown[path+key] = true
+		}
+	}
+}
+
+// Warns about fields of the reviews JSON the parser doesn't know.
+// They are harmless, but often the first sign of an API change. Every field is only reported once per run
+type fieldWarner struct {
+	mu     sync.Mutex
+	warned map[string]bool
+	w      io.Writer
+}
+
+var unknownFieldWarner = &fieldWarner{warned: make(map[string]bool), w: os.Stderr}
+
+func (fw *fieldWarner) warn(fields []string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	for _, field := range fields {
+		if fw.warned[field] {
+			continue
+		}
+		fw.warned[field] = true
+		fmt.Fprintf(fw.w, "Warning: unknown field '%s' in the reviews JSON. The API might have changed (use -strict-schema to fail on it)\n", field)
+	}
+}
+
+// Validates a reviews JSON against rawResp.
+// Returns a *SchemaError if required fields are missing or values have the wrong type.
+// Unknown fields only lead to an error in strict mode, otherwise a warning is printed.
+func validateReviewsJson(json_raw []byte, strict bool) error {
+	report := schemaReport{
+		missing: make(map[string]bool),
+		unknown: make(map[string]bool),
+		invalid: make(map[string]bool),
+	}
+	report.validateObject(json_raw, reflect.TypeOf(rawResp{}), "")
+	if !strict {
+		unknownFieldWarner.warn(sortedKeys(report.unknown))
+	}
+
+	if len(report.missing) == 0 && len(report.invalid) == 0 && (!strict || len(report.unknown) == 0) {
+		return nil
+	}
+	return &SchemaError{
+		Missing: sortedKeys(report.missing),
+		Unknown: sortedKeys(report.unknown),
+		Invalid: sortedKeys(report.invalid),
+	}
+}
@@ -0,0 +1,129 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+func TestValidateReviewsJson(t *testing.T) {
+	valid := []byte(`{"pageInfo":{"hasNextPage":true,"endCursor":"c1"},"reviews":[{"originalScore":"3/5","mediaTitle":"Movie","mediaUrl":"/m/movie"}]}`)
+	if err := validateReviewsJson(valid, true); err != nil {
+		t.Errorf("Expected valid JSON to pass. Got %v", err)
+	}
+	// reviews without a score only have a sentiment
+	unscored := []byte(`{"pageInfo":{"hasNextPage":false,"endCursor":""},"reviews":[{"mediaTitle":"Movie","mediaUrl":"/m/movie","scoreSentiment":"POSITIVE"}]}`)
+	if err := validateReviewsJson(unscored, true); err != nil {
+		t.Errorf("Expected a review without a score to pass. Got %v", err)
+	}
+
+	missing := []byte(`{"pageInfo":{"hasNextPage":true,"endCursor":"c1"},"reviews":[{"originalScore":"3/5","title":"Movie","mediaUrl":"/m/movie"}]}`)
+	err := validateReviewsJson(missing, false)
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("Expected SchemaError. Got %v", err)
+	}
+	if !reflect.DeepEqual(schemaErr.Missing, []string{"reviews[].mediaTitle"}) {
+		t.Errorf("Expected 'reviews[].mediaTitle' to be missing. Got %v", schemaErr.Missing)
+	}
+	if !reflect.DeepEqual(schemaErr.Unknown, []string{"reviews[].title"}) {
+		t.Errorf("Expected 'reviews[].title' to be unknown. Got %v", schemaErr.Unknown)
+	}
+
+	invalid := []byte(`{"pageInfo":{"hasNextPage":"yes","endCursor":"c1"},"reviews":{}}`)
+	if err := validateReviewsJson(invalid, false); !errors.As(err, &schemaErr) || len(schemaErr.Invalid) != 2 {
+		t.Errorf("Expected 2 invalid values. Got %v", err)
+	}
+}
+
+func TestValidateReviewsJsonUnknownFields(t *testing.T) {
+	var warnings bytes.Buffer
+	unknownFieldWarner = &fieldWarner{warned: make(map[string]bool), w: &warnings}
+	defer func() { unknownFieldWarner = &fieldWarner{warned: make(map[string]bool), w: os.Stderr} }()
+
+	extra := []byte(`{"pageInfo":{"hasNextPage":false,"endCursor":""},"reviews":[{"mediaUrl":"/m/a","mediaTitle":"A","originalScore":"","badge":1},{"mediaUrl":"/m/b","mediaTitle":"B","originalScore":"","badge":2}],"ads":[]}`)
+	if err := validateReviewsJson(extra, false); err != nil {
+		t.Errorf("Expected unknown fields to be ignored. Got %v", err)
+	}
+	// the warning names each field only once, even across JSONs
+	validateReviewsJson(extra, false)
+	expected := "Warning: unknown field 'ads' in the reviews JSON. The API might have changed (use -strict-schema to fail on it)\n" +
+		"Warning: unknown field 'reviews[].badge' in the reviews JSON. The API might have changed (use -strict-schema to fail on it)\n"
+	if warnings.String() != expected {
+		t.Errorf("Expected\n%s\nGot\n%s", expected, warnings.String())
+	}
+
+	if err := validateReviewsJson(extra, true); err == nil {
+		t.Errorf("Expected unknown fields to be an error in strict mode")
+	}
+}
+
+func TestFetchAllReviewsAbortsOnSchemaErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>We redesigned our site!</body></html>"))
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	outDir := path.Join(dir, "reviews")
+	critics := []Critic{{Url: "critic-a"}, {Url: "critic-b"}, {Url: "critic-c"}, {Url: "critic-d"}}
+	mustWrite(t, critics, criticsFile)
+
+	f.fetch_all_reviews(context.Background(), criticsFile, outDir, crawlOptions{workers: 1, mediaTypes: []utils.MediaType{utils.MediaTypeMovie}, maxSchemaErrors: 2})
+
+	states, err := readJournal(path.Join(outDir, JOURNAL_FILE))
+	if err != nil {
+		t.Fatalf("Can't read journal: %v", err)
+	}
+	if states["critic-a"] != stateFailed || states["critic-b"] != stateFailed {
+		t.Errorf("Expected the first two critics to have failed. Got %v", states)
+	}
+	if _, ok := states["critic-c"]; ok {
+		t.Errorf("Expected critic-c not to be attempted after the abort. Got '%s'", states["critic-c"])
+	}
+}
+
+func TestSchemaErrorsAreCountedInARow(t *testing.T) {
+	base := newTestServer(t)
+	defer base.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/critics/odd-") {
+			w.Write([]byte("<html><body>Some odd page</body></html>"))
+			return
+		}
+		base.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	f, _ := newTestFetcher(server)
+
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	outDir := path.Join(dir, "reviews")
+	critics := []Critic{{Url: "odd-a"}, {Url: "alice-example"}, {Url: "odd-b"}, {Url: "odd-c"}, {Url: "odd-d"}}
+	mustWrite(t, critics, criticsFile)
+
+	f.fetch_all_reviews(context.Background(), criticsFile, outDir, crawlOptions{workers: 1, mediaTypes: []utils.MediaType{utils.MediaTypeMovie}, maxSchemaErrors: 2})
+
+	states, err := readJournal(path.Join(outDir, JOURNAL_FILE))
+	if err != nil {
+		t.Fatalf("Can't read journal: %v", err)
+	}
+	// alice-example resets the count, so only odd-b and odd-c abort the crawl
+	if states["alice-example"] != stateDone || states["odd-c"] != stateFailed {
+		t.Errorf("Expected the crawl to go on until odd-c. Got %v", states)
+	}
+	if _, ok := states["odd-d"]; ok {
+		t.Errorf("Expected odd-d not to be attempted after the abort. Got '%s'", states["odd-d"])
+	}
+}
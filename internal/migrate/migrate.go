@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Migrates a file with records of the given type in place
+var migrators = map[string]func(filePath string) (utils.FileHeader, error){
+	"Critic":        utils.MigrateFile[utils.Critic],
+	"Review":        utils.MigrateFile[utils.Review],
+	"NumericReview": utils.MigrateFile[utils.NumericReview],
+	"Media":         utils.MigrateFile[utils.Media],
+}
+
+// Returns all .gob files in the given files and directories (recursively)
+func collectFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && path.Ext(filePath) == ".gob" {
+				files = append(files, filePath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Determines the record type of the file: from its header, the -type flag or the start of the gob stream (in that order)
+func recordTypeOf(filePath string, header utils.FileHeader, hasHeader bool, forcedType string) (string, error) {
+	if hasHeader {
+		return header.RecordType, nil
+	}
+	if forcedType != "" {
+		return forcedType, nil
+	}
+	guess, err := utils.GuessRecordType(filePath)
+	if err != nil {
+		return "", err
+	}
+	if guess == "" {
+		return "", fmt.Errorf("%s: can't tell what records it contains (use -type)", filePath)
+	}
+	return guess, nil
+}
+
+// Upgrades a single file. Returns whether it was (or with dryRun: would be) changed
+func migrateFile(filePath, forcedType string, dryRun bool) (bool, error) {
+	header, hasHeader, err := utils.ReadFileHeader(filePath)
+	if err != nil {
+		return false, err
+	}
+	recordType, err := recordTypeOf(filePath, header, hasHeader, forcedType)
+	if err != nil {
+		return false, err
+	}
+	migrator, ok := migrators[recordType]
+	if !ok {
+		return false, fmt.Errorf("%s: unknown record type '%s'", filePath, recordType)
+	}
+
+	current := utils.SchemaVersions[recordType]
+	if hasHeader && header.SchemaVersion == current {
+		fmt.Printf("%s: %s v%d, up to date\n", filePath, recordType, current)
+		return false, nil
+	}
+	if header.SchemaVersion > current {
+		return false, fmt.Errorf("%s: has version %d of %s, but this program only knows up to version %d", filePath, header.SchemaVersion, recordType, current)
+	}
+
+	from := fmt.Sprintf("v%d", header.SchemaVersion)
+	if !hasHeader {
+		from = "legacy file without header"
+	}
+	if dryRun {
+		fmt.Printf("%s: %s %s -> v%d (dry run)\n", filePath, recordType, from, current)
+		return true, nil
+	}
+	if _, err := migrator(filePath); err != nil {
+		return false, err
+	}
+	fmt.Printf("%s: %s %s -> v%d\n", filePath, recordType, from, current)
+	return true, nil
+}
+
+func MigrateMain(args []string) {
+	migrateSet := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var forcedType = migrateSet.String("type", "", "Record type of files without a header ('Critic', 'Review', 'NumericReview' or 'Media'). Guessed if not given")
+	var dryRun = migrateSet.Bool("dry-run", false, "Only print which files would be migrated")
+	migrateSet.Usage = func() {
+		fmt.Fprintln(migrateSet.Output(), "Usage: migrate [flags] [files or directories...] (defaults to ./tmp)")
+		migrateSet.PrintDefaults()
+	}
+	migrateSet.Parse(args)
+
+	paths := migrateSet.Args()
+	if len(paths) == 0 {
+		paths = []string{path.Dir(utils.DefaultCriticsFile)}
+	}
+
+	files, err := collectFiles(paths)
+	if err != nil {
+		panic(err)
+	}
+
+	migrated, failed := 0, 0
+	for _, file := range files {
+		changed, err := migrateFile(file, *forcedType, *dryRun)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		if changed {
+			migrated++
+		}
+	}
+
+	fmt.Printf("%d files, %d migrated, %d up to date, %d failed\n", len(files), migrated, len(files)-migrated-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Writes the records as a bare gob stream, like the files written before there was a header
+func writeLegacy[T any](t *testing.T, records []T, fileName string) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			t.Fatalf("Can't encode legacy record: %v", err)
+		}
+	}
+	if err := os.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Can't write %s: %v", fileName, err)
+	}
+}
+
+// Writes the records behind a header with the given (older) schema version
+func writeVersion[T any](t *testing.T, recordType string, version int, records []T, fileName string) {
+	var buf bytes.Buffer
+	buf.WriteString("\x00CFDS")
+	enc := gob.NewEncoder(&buf)
+	header := utils.FileHeader{RecordType: recordType, SchemaVersion: version, Created: time.Date(2023, 9, 17, 12, 0, 0, 0, time.UTC), CreatedBy: "test"}
+	if err := enc.Encode(header); err != nil {
+		t.Fatalf("Can't encode header: %v", err)
+	}
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			t.Fatalf("Can't encode record: %v", err)
+		}
+	}
+	if err := os.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Can't write %s: %v", fileName, err)
+	}
+}
+
+func TestMigrateFiles(t *testing.T) {
+	// the layouts before media types existed
+	type Media struct {
+		MediaTitle string
+		MediaUrl   string
+	}
+	type Review struct {
+		Score    string
+		MediaUrl string
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(path.Join(dir, "reviews"), os.ModePerm)
+	mediaFile := path.Join(dir, "movies.gob")
+	reviewsFile := path.Join(dir, "reviews", "bob.gob")
+	criticsFile := path.Join(dir, "critics.gob")
+	writeLegacy(t, []Media{{MediaTitle: "Some Movie", MediaUrl: "/m/some_movie"}}, mediaFile)
+	writeVersion(t, "Review", 1, []Review{{Score: "4/5", MediaUrl: "/m/some_movie"}}, reviewsFile)
+	utils.WriteStructs(context.Background(), []utils.Critic{{Url: "bob"}}, criticsFile, false)
+	os.WriteFile(path.Join(dir, "reviews", "journal.jsonl"), []byte("{}\n"), 0644)
+
+	files, err := collectFiles([]string{dir})
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected the 3 .gob files. Got %v", files)
+	}
+
+	// a dry run doesn't change anything
+	if changed, err := migrateFile(reviewsFile, "", true); err != nil || !changed {
+		t.Errorf("Expected the reviews to need a migration. Got %v (%v)", changed, err)
+	}
+	if header, _, _ := utils.ReadFileHeader(reviewsFile); header.SchemaVersion != 1 {
+		t.Errorf("Expected the dry run to leave the file alone. Got %v", header)
+	}
+
+	for _, file := range files {
+		changed, err := migrateFile(file, "", false)
+		if err != nil {
+			t.Fatalf("Expected no error for %s. Got %v", file, err)
+		}
+		if changed != (file != criticsFile) {
+			t.Errorf("Expected only the outdated files to be migrated. %s changed: %v", file, changed)
+		}
+	}
+
+	header, ok, err := utils.ReadFileHeader(mediaFile)
+	if err != nil || !ok || header.RecordType != "Media" || header.SchemaVersion != utils.SchemaVersions["Media"] || header.MigratedFrom != utils.LegacySchemaVersion {
+		t.Errorf("Expected the legacy media file to be migrated to the current version. Got %+v (%v, %v)", header, ok, err)
+	}
+	media, err := utils.ReadStructs[utils.Media](mediaFile, false)
+	if err != nil || len(media) != 1 || media[0].MediaTitle != "Some Movie" || media[0].MediaType != utils.MediaTypeMovie {
+		t.Errorf("Expected the medium to be a movie now. Got %+v (%v)", media, err)
+	}
+
+	header, _, _ = utils.ReadFileHeader(reviewsFile)
+	if header.SchemaVersion != utils.SchemaVersions["Review"] || header.MigratedFrom != 1 || header.Migrated.IsZero() {
+		t.Errorf("Expected the reviews to be migrated from version 1. Got %+v", header)
+	}
+	if !header.Created.Equal(time.Date(2023, 9, 17, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the creation time to be kept. Got %v", header.Created)
+	}
+	reviews, err := utils.ReadStructs[utils.Review](reviewsFile, false)
+	if err != nil || len(reviews) != 1 || reviews[0].Score != "4/5" || reviews[0].MediaType != utils.MediaTypeMovie {
+		t.Errorf("Expected the review to be a movie review now. Got %+v (%v)", reviews, err)
+	}
+
+	// running it again finds nothing to do
+	for _, file := range files {
+		if changed, err := migrateFile(file, "", false); err != nil || changed {
+			t.Errorf("Expected %s to be up to date. Got %v (%v)", file, changed, err)
+		}
+	}
+}
+
+func TestMigrateUnknownFile(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "mystery.gob")
+	type Mystery struct{ Value int }
+	writeLegacy(t, []Mystery{{Value: 1}}, fileName)
+
+	if _, err := migrateFile(fileName, "", false); err == nil {
+		t.Errorf("Expected an error for a file with unknown records")
+	}
+	if _, err := migrateFile(fileName, "Nope", false); err == nil {
+		t.Errorf("Expected an error for an unknown record type")
+	}
+}
@@ -2,16 +2,18 @@
 package normalize
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"math"
 	"os"
 	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/MamfTheKramf/critics_finder/internal/utils"
+	"github.com/MamfTheKramf/critics_finder/internal/workqueue"
 )
 
 var (
@@ -101,43 +103,65 @@ type WorkerResult struct {
 	errorScores int
 }
 
-func normalizeReviews(reviewFile, outDir string) (WorkerResult, error) {
+// Normalizes the reviews of the given media types inside reviewFile and writes them to a file with the same name in outDir.
+// If ctx is cancelled while writing, the file in outDir is left as it was and the context's error is returned.
+func normalizeReviews(ctx context.Context, reviewFile, outDir string, mediaTypes []utils.MediaType) (WorkerResult, error) {
 	errors := strings.Builder{}
 	emptyScores := 0
 	errorScores := 0
 	normalized := 0
 	var media []utils.Media
 
-	var normalizedReviews []utils.NumericReview
+	fileName := path.Join(outDir, path.Base(reviewFile))
+	w, err := utils.CreateStructs[utils.NumericReview](fileName)
+	if err != nil {
+		return WorkerResult{}, err
+	}
 
-	reviews := utils.ReadStructs[utils.Review](reviewFile, false)
-	for _, review := range reviews {
+	// the reviews are streamed from reviewFile into the new file one at a time
+	err = utils.EachStruct(reviewFile, func(review utils.Review) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !utils.ContainsMediaType(mediaTypes, review.MediaType) {
+			return nil
+		}
 		if review.Score == "" {
 			emptyScores++
-			continue
+			return nil
 		}
 		normalizedScore, err := normalizeRating(review.Score)
 		if err != nil {
 			errors.WriteString(err.Error())
 			errors.WriteString("\n")
 			errorScores++
-			continue
+			return nil
 		}
 
 		normalized++
-		normalizedReviews = append(normalizedReviews, utils.NumericReview{
-			Score:    normalizedScore,
-			MediaUrl: review.MediaUrl,
+		err = w.Write(utils.NumericReview{
+			Score:     normalizedScore,
+			MediaUrl:  review.MediaUrl,
+			MediaType: review.MediaType.OrDefault(),
 		})
+		if err != nil {
+			return err
+		}
 		media = append(media, utils.Media{
 			MediaTitle: review.MediaTitle,
 			MediaInfo:  review.MediaInfo,
 			MediaUrl:   review.MediaUrl,
+			MediaType:  review.MediaType.OrDefault(),
 		})
+		return nil
+	})
+	if err != nil {
+		w.Abort()
+		return WorkerResult{}, err
+	}
+	if _, err := w.Commit(); err != nil {
+		return WorkerResult{}, err
 	}
-
-	fileName := path.Join(outDir, path.Base(reviewFile))
-	utils.WriteStructs[utils.NumericReview](normalizedReviews, fileName, false)
 
 	if errorScores > 0 {
 		return WorkerResult{}, fmt.Errorf(errors.String())
@@ -150,117 +174,122 @@ func normalizeReviews(reviewFile, outDir string) (WorkerResult, error) {
 	}, nil
 }
 
-// normalizes each review inside each of the review files and writes them to a new file in outDir
-func normalizeWorker(channel chan<- bool, reviewFiles []os.DirEntry, inDir, outDir string, resultsChannel chan<- WorkerResult) {
-	workerResult := WorkerResult{
-		media: []utils.Media{},
-	}
-	for _, reviewFile := range reviewFiles {
-		path := path.Join(inDir, reviewFile.Name())
-		funcResult, err := normalizeReviews(path, outDir)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v", err)
-		}
-		channel <- err == nil
-
-		workerResult.emptyScores += funcResult.emptyScores
-		workerResult.errorScores += funcResult.errorScores
-		workerResult.normalized += funcResult.normalized
-		workerResult.media = append(workerResult.media, funcResult.media...)
-	}
-
-	resultsChannel <- workerResult
-}
-
 func NormalizeMain(args []string) {
 	var inDir = flag.String("i", utils.DefaultReviewsDir, "Path to the directory containing the reviews")
 	var outDir = flag.String("o", utils.DefaultNormalizedDir, "Path to the directory to write normalized reviews to")
 	var moviesFile = flag.String("m", utils.DefaultMediaFile, "Path to file to store movies in")
 	var workers = flag.Int("w", 1, "Number of workers to normalize reviews")
+	var mediaSelection = flag.String("media", "all", "Which reviews to normalize ('movie', 'tv' or 'all')")
+	var newReporter = workqueue.AddFlag(flag.CommandLine)
 	os.Args = append(os.Args[:1], args...)
 	flag.Parse()
 
-	fmt.Println(*inDir, *outDir, *moviesFile, *workers)
-
-	entries, err := os.ReadDir(*inDir)
+	reporter, err := newReporter()
 	if err != nil {
 		panic(err)
 	}
 
-	err = os.MkdirAll(*outDir, os.ModePerm)
+	mediaTypes, err := utils.ParseMediaTypes(*mediaSelection)
 	if err != nil {
 		panic(err)
 	}
 
-	progressChannel := make(chan bool, 1)
-	defer close(progressChannel)
-	resultsChannel := make(chan WorkerResult, *workers)
-	defer close(resultsChannel)
-
-	stepSize := int(math.Ceil(float64(len(entries)) / float64(*workers)))
+	fmt.Println(*inDir, *outDir, *moviesFile, *workers)
 
-	for i := 0; i < *workers; i++ {
-		lower := i * stepSize
-		upper := utils.Min(len(entries), lower+stepSize)
+	ctx, stop := utils.InterruptContext()
+	defer stop()
 
-		go normalizeWorker(progressChannel, entries[lower:upper], *inDir, *outDir, resultsChannel)
+	dirEntries, err := os.ReadDir(*inDir)
+	if err != nil {
+		panic(err)
 	}
-
-	doneTotal := 0
-	finished := 0
-	errors := 0
-
-	for doneTotal < len(entries) {
-		res := <-progressChannel
-		doneTotal++
-		if res {
-			finished++
-		} else {
-			errors++
-		}
-
-		if doneTotal&10 == 0 {
-			fmt.Printf("%.2f%% done; %d finished; %d errors\r",
-				100.0*float32(doneTotal)/float32(len(entries)),
-				finished,
-				errors)
+	// the reviews directory also contains the journal of the fetch command
+	var entries []os.DirEntry
+	for _, entry := range dirEntries {
+		if !entry.IsDir() && path.Ext(entry.Name()) == ".gob" {
+			entries = append(entries, entry)
 		}
 	}
-	fmt.Printf("%.2f%% done; %d finished; %d errors\n",
-		100.0*float32(doneTotal)/float32(len(entries)),
-		finished,
-		errors)
 
-	totalResult := WorkerResult{
-		media: []utils.Media{},
+	err = os.MkdirAll(*outDir, os.ModePerm)
+	if err != nil {
+		panic(err)
 	}
-	for i := 0; i < *workers; i++ {
-		result := <-resultsChannel
+
+	// a file that is interrupted while being written is left as it was and counts as not normalized
+	var mu sync.Mutex
+	totalResult := WorkerResult{}
+	// media are deduped right away, so they don't pile up for millions of reviews
+	mediaMap := make(map[string]utils.Media)
+	nonDedupped := 0
+	progress, _ := workqueue.Run(ctx, len(entries), workqueue.Options{
+		Workers:  *workers,
+		Label:    "Normalizing reviews",
+		Reporter: reporter,
+	}, func(ctx context.Context, idx int) error {
+		result, err := normalizeReviews(ctx, path.Join(*inDir, entries[idx].Name()), *outDir, mediaTypes)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "%v\n", strings.TrimSuffix(err.Error(), "\n"))
+			}
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
 		totalResult.emptyScores += result.emptyScores
 		totalResult.errorScores += result.errorScores
 		totalResult.normalized += result.normalized
-		totalResult.media = append(totalResult.media, result.media...)
+		nonDedupped += len(result.media)
+		for _, medium := range result.media {
+			mediaMap[medium.MediaUrl] = medium
+		}
+		return nil
+	})
+	fmt.Printf("%d finished; %d errors\n", progress.Done-progress.Failed, progress.Failed)
+
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		fmt.Fprintf(os.Stderr, "Interrupted. %d review files were not normalized. Run the command again to normalize all of them.\n", len(entries)-progress.Done)
 	}
 
 	fmt.Printf("normalized: %d\n", totalResult.normalized)
 	fmt.Printf("totalEmptyScores: %d\n", totalResult.emptyScores)
 	fmt.Printf("totalErrorScores: %d\n", totalResult.errorScores)
-	fmt.Printf("non-dedupped media len: %d\n", len(totalResult.media))
-
-	fmt.Println("\nDeduping media...")
+	fmt.Printf("non-dedupped media len: %d\n", nonDedupped)
+	fmt.Printf("dedupped media len: %d\n", len(mediaMap))
 
-	mediaMap := make(map[string]utils.Media)
-	for _, media := range totalResult.media {
-		mediaMap[media.MediaUrl] = media
+	// keep the metadata added by 'fetch media' to an earlier version of the media file.
+	// When interrupted, the media of the files that weren't normalized again are kept as well
+	if _, err := os.Stat(*moviesFile); err == nil {
+		oldMedia, err := utils.ReadStructs[utils.Media](*moviesFile, false)
+		if err != nil {
+			// the records before a corrupt one are still good
+			fmt.Fprintf(os.Stderr, "Can't read all of the old media file: %v\n", err)
+		}
+		kept := 0
+		for _, oldMedium := range oldMedia {
+			medium, prs := mediaMap[oldMedium.MediaUrl]
+			if !prs && interrupted {
+				mediaMap[oldMedium.MediaUrl] = oldMedium
+				continue
+			}
+			if prs && oldMedium.MetadataFetched {
+				medium.MediaMetadata = oldMedium.MediaMetadata
+				mediaMap[oldMedium.MediaUrl] = medium
+				kept++
+			}
+		}
+		fmt.Printf("kept metadata of %d media\n", kept)
 	}
 
-	fmt.Printf("dedupped media len: %d\n", len(mediaMap))
-
 	deduppedMedia := []utils.Media{}
 	for _, v := range mediaMap {
 		deduppedMedia = append(deduppedMedia, v)
 	}
 
 	fmt.Println("\nWrite media struct...")
-	utils.WriteStructs[utils.Media](deduppedMedia, *moviesFile, false)
+	if _, err := utils.WriteStructs[utils.Media](context.Background(), deduppedMedia, *moviesFile, false); err != nil {
+		panic(err)
+	}
 }
@@ -1,8 +1,13 @@
 package normalize
 
 import (
+	"context"
 	"math"
+	"os"
+	"path"
 	"testing"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
 )
 
 func TestNormalizeFraction(t *testing.T) {
@@ -90,3 +95,40 @@ func TestStarsRatings(t *testing.T) {
 	}
 
 }
+
+func TestNormalizeReviews(t *testing.T) {
+	dir := t.TempDir()
+	reviewFile := path.Join(dir, "bob.gob")
+	outDir := path.Join(dir, "normalized")
+	os.MkdirAll(outDir, os.ModePerm)
+	utils.WriteStructs(context.Background(), []utils.Review{
+		{Score: "4/5", MediaUrl: "/m/some_movie", MediaTitle: "Some Movie"},
+		{Score: "", MediaUrl: "/m/other_movie"},
+		{Score: "B", MediaUrl: "/tv/some_show", MediaType: utils.MediaTypeTv},
+	}, reviewFile, false)
+
+	result, err := normalizeReviews(context.Background(), reviewFile, outDir, utils.MediaTypes)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if result.normalized != 2 || result.emptyScores != 1 || len(result.media) != 2 {
+		t.Errorf("Expected 2 normalized reviews and 1 empty score. Got %+v", result)
+	}
+	normalized, err := utils.ReadStructs[utils.NumericReview](path.Join(outDir, "bob.gob"), false)
+	if err != nil || len(normalized) != 2 || normalized[0].Score != 0.8 || normalized[1].MediaType != utils.MediaTypeTv {
+		t.Errorf("Expected the normalized reviews in order. Got %+v (%v)", normalized, err)
+	}
+
+	// a cancelled run leaves the file as it was
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := normalizeReviews(ctx, reviewFile, outDir, []utils.MediaType{utils.MediaTypeMovie}); err == nil {
+		t.Errorf("Expected an error for a cancelled run")
+	}
+	if again, _ := utils.ReadStructs[utils.NumericReview](path.Join(outDir, "bob.gob"), false); len(again) != 2 {
+		t.Errorf("Expected the file to be left as it was. Got %+v", again)
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 1 {
+		t.Errorf("Expected no temporary file to be left behind. Got %v", entries)
+	}
+}
@@ -1,10 +1,15 @@
 package tui
 
 import (
+	"context"
+	"errors"
+	"io/fs"
 	"math"
+	"path"
 	"slices"
 
 	"github.com/MamfTheKramf/critics_finder/internal/utils"
+	"github.com/MamfTheKramf/critics_finder/internal/workqueue"
 )
 
 // contains a critic together with a score describing how close the critic rates movies to the reference ratings.
@@ -15,24 +20,28 @@ type ScoredCritic struct {
 
 // Compares the ratings of each critic with the userRatings and assigns each critic a score.
 // smaller scores are better. Critics that didn't rate any of the movies rated by the user get a score of infinity
+// The ratings of each critic are streamed from their file in ratingsDir, so only the files currently scored are open.
+// Critics whose file is unreadable get a score of infinity as well; their errors are returned.
 // The returned slice is already sorted
-func evaluate(userRatings []utils.NumericReview, criticsRatings map[string][]utils.NumericReview, critics []utils.Critic, workers int) []ScoredCritic {
-	resultsChannel := make(chan []ScoredCritic, workers)
-	defer close(resultsChannel)
-
-	stepSize := int(math.Ceil(float64(len(critics)) / float64(workers)))
-	for i := 0; i < workers; i++ {
-		lower := i * stepSize
-		upper := utils.Min(len(critics), lower+stepSize)
-
-		go evalWorker(resultsChannel, userRatings, criticsRatings, critics[lower:upper])
+func evaluate(userRatings []utils.NumericReview, ratingsDir string, critics []utils.Critic, workers int, reporter workqueue.Reporter) ([]ScoredCritic, []error) {
+	// only the first rating of each medium counts
+	userScores := make(map[string]float32, len(userRatings))
+	for _, rating := range userRatings {
+		if _, prs := userScores[rating.MediaUrl]; !prs {
+			userScores[rating.MediaUrl] = rating.Score
+		}
 	}
 
-	var scoredCritics []ScoredCritic
-	for i := 0; i < workers; i++ {
-		workerRes := <-resultsChannel
-		scoredCritics = append(scoredCritics, workerRes...)
-	}
+	scoredCritics := make([]ScoredCritic, len(critics))
+	_, errs := workqueue.Run(context.Background(), len(critics), workqueue.Options{
+		Workers:  workers,
+		Label:    "Evaluating critics",
+		Reporter: reporter,
+	}, func(ctx context.Context, idx int) error {
+		var err error
+		scoredCritics[idx], err = scoreCritic(userScores, ratingsDir, critics[idx])
+		return err
+	})
 
 	slices.SortFunc(scoredCritics, func(a, b ScoredCritic) int {
 		if a.Score < b.Score {
@@ -43,44 +52,35 @@ func evaluate(userRatings []utils.NumericReview, criticsRatings map[string][]uti
 		return 0
 	})
 
-	return scoredCritics
+	return scoredCritics, errs
 }
 
-// Scores each critics ratings against the user ratings and writes the ScoredCritics to the resChannel.
-// The returned slice is not sorted
-func evalWorker(resChannel chan []ScoredCritic, userRatings []utils.NumericReview, criticsRatings map[string][]utils.NumericReview, critics []utils.Critic) {
-	scoredCritics := make([]ScoredCritic, 0, len(critics))
-
-	for _, critic := range critics {
-		score := math.Inf(1)
-		criticRatings, prs := criticsRatings[critic.Url]
-		if prs {
-			score = eval(userRatings, criticRatings)
-		}
+// Scores the critic's ratings against the user ratings (media URL to score)
+func scoreCritic(userScores map[string]float32, ratingsDir string, critic utils.Critic) (ScoredCritic, error) {
+	scored := ScoredCritic{Score: math.Inf(1), Critic: critic}
 
-		scoredCritics = append(scoredCritics, ScoredCritic{Score: score, Critic: critic})
-	}
-
-	resChannel <- scoredCritics
-}
-
-func eval(userRatings, criticRatings []utils.NumericReview) float64 {
 	totalErr := 0.0
-	totalMatches := 0
-	for _, userRating := range userRatings {
-		matchIdx := slices.IndexFunc(criticRatings, func(candidate utils.NumericReview) bool { return candidate.MediaUrl == userRating.MediaUrl })
-		if matchIdx < 0 {
-			continue
+	// the first rating of a medium counts, like for the user
+	matched := make(map[string]bool)
+	err := utils.EachStruct(path.Join(ratingsDir, critic.Url+".gob"), func(criticRating utils.NumericReview) error {
+		userScore, prs := userScores[criticRating.MediaUrl]
+		if !prs || matched[criticRating.MediaUrl] {
+			return nil
 		}
-
-		criticRating := criticRatings[matchIdx]
-
-		totalErr += math.Pow(float64(userRating.Score)-float64(criticRating.Score), 2.0)
-		totalMatches++
+		matched[criticRating.MediaUrl] = true
+		totalErr += math.Pow(float64(userScore)-float64(criticRating.Score), 2.0)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		// critic without (normalized) reviews
+		return scored, nil
+	}
+	if err != nil {
+		return scored, err
 	}
 
-	if totalMatches == 0 {
-		return math.Inf(1)
+	if len(matched) > 0 {
+		scored.Score = totalErr / float64(len(matched))
 	}
-	return totalErr / float64(totalMatches)
+	return scored, nil
 }
@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"context"
+	"math"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+	"github.com/MamfTheKramf/critics_finder/internal/workqueue"
+)
+
+func TestEvaluate(t *testing.T) {
+	dir := t.TempDir()
+	utils.WriteStructs(context.Background(), []utils.NumericReview{
+		{Score: 0.8, MediaUrl: "/m/first_movie"},
+		{Score: 0.4, MediaUrl: "/m/second_movie"},
+		// only the first rating of a medium counts
+		{Score: 0.0, MediaUrl: "/m/first_movie"},
+	}, path.Join(dir, "close.gob"), false)
+	utils.WriteStructs(context.Background(), []utils.NumericReview{{Score: 0.0, MediaUrl: "/m/first_movie"}}, path.Join(dir, "far.gob"), false)
+	utils.WriteStructs(context.Background(), []utils.NumericReview{{Score: 0.5, MediaUrl: "/m/other_movie"}}, path.Join(dir, "unrelated.gob"), false)
+	os.WriteFile(path.Join(dir, "broken.gob"), []byte("\x00CFDS garbage"), 0644)
+
+	userRatings := []utils.NumericReview{{Score: 1.0, MediaUrl: "/m/first_movie"}, {Score: 0.4, MediaUrl: "/m/second_movie"}}
+	critics := []utils.Critic{{Url: "far"}, {Url: "unrelated"}, {Url: "close"}, {Url: "missing"}, {Url: "broken"}}
+	scored, errs := evaluate(userRatings, dir, critics, 2, workqueue.None)
+
+	if len(errs) != 1 || !utils.IsCorrupt(errs[0]) {
+		t.Errorf("Expected the broken file to be reported. Got %v", errs)
+	}
+	if scored[0].Critic.Url != "close" || math.Abs(scored[0].Score-0.02) > 1e-6 {
+		t.Errorf("Expected 'close' to be first with score 0.02. Got %v", scored[0])
+	}
+	if scored[1].Critic.Url != "far" || math.Abs(scored[1].Score-1.0) > 1e-6 {
+		t.Errorf("Expected 'far' to be second with score 1. Got %v", scored[1])
+	}
+	for _, critic := range scored[2:] {
+		if !math.IsInf(critic.Score, 1) {
+			t.Errorf("Expected critic without matches to score infinity. Got %v", critic)
+		}
+	}
+}
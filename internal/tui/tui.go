@@ -1,15 +1,16 @@
 package tui
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
-	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/MamfTheKramf/critics_finder/internal/utils"
+	"github.com/MamfTheKramf/critics_finder/internal/workqueue"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/sahilm/fuzzy"
@@ -49,11 +50,15 @@ var controls = tview.NewTextView()
 
 var userRatings []utils.NumericReview
 var critics []utils.Critic
-var criticsRatings = make(map[string][]utils.NumericReview)
 
-// critic ratings are read in a separate routing -> we need an indicator that we're done before comparing
-var doneReadingcriticsRatings = make(chan bool, 1)
-var criticRatingsAlreadyRead = false
+// directory with a file of normalized ratings per critic. They are only read while evaluating, one critic at a time
+var criticsRatingsDir string
+
+// errors of the critics' rating files that couldn't be read in the last evaluation. Those critics are left out
+var unreadableRatings []error
+
+// problems with the files read on startup that are shown above the main sections
+var loadWarnings []string
 var media []utils.Media
 var urlToMedia = make(map[string]utils.Media)
 var selected utils.Media
@@ -64,36 +69,90 @@ var mediaNames []string
 
 var workers = 1
 
+// media types that can be rated and are used for matching
+var mediaTypes = utils.MediaTypes
+
+// only match critics that are top critics
+var topCriticsOnly = false
+
+// only match critics writing for one of these publications (all critics if empty)
+var publications []string
+
 func StartTui(args []string) {
 	userRatingsFile := flag.String("u", utils.DefaultUserRatingsFile, "Path to the user ratings file (if non-existing it will be created)")
 	criticsFile := flag.String("c", utils.DefaultCriticsFile, "Path to crtics file")
 	inDir := flag.String("i", utils.DefaultNormalizedDir, "Path to directory containing normalized reviews")
 	mediaFile := flag.String("m", utils.DefaultMediaFile, "Path to media file")
 	flag.IntVar(&workers, "w", 1, "Number of workers used for evaluation")
+	mediaSelection := flag.String("media", "all", "Which media to rate and match critics on ('movie', 'tv' or 'all')")
+	flag.BoolVar(&topCriticsOnly, "top", false, "Only match top critics (requires 'fetch profiles')")
+	publicationsList := flag.String("publications", "", "Comma separated list of publications. Only critics writing for one of them are matched (requires 'fetch profiles')")
 	os.Args = append(os.Args[:1], args...)
 	flag.Parse()
 
-	setup(*userRatingsFile, *criticsFile, *inDir, *mediaFile)
+	var err error
+	mediaTypes, err = utils.ParseMediaTypes(*mediaSelection)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *publicationsList != "" {
+		publications = strings.Split(*publicationsList, ",")
+	}
+
+	if err := setup(*userRatingsFile, *criticsFile, *inDir, *mediaFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	defer writeUserRatings(*userRatingsFile)
 
 	if err := app.SetRoot(layers, true).EnableMouse(true).SetFocus(searchQuery).Run(); err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	for _, err := range unreadableRatings {
+		fmt.Fprintf(os.Stderr, "Skipped critic: %v\n", err)
 	}
 }
 
 func writeUserRatings(outFile string) {
-	utils.WriteStructs[utils.NumericReview](userRatings, outFile, false)
+	if _, err := utils.WriteStructs[utils.NumericReview](context.Background(), userRatings, outFile, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't save your ratings: %v\n", err)
+	}
 }
 
-func setup(userRatingsFile, criticsFile, criticsRatingDir, mediaFile string) {
-	readUserRatings(userRatingsFile)
-	readCritics(criticsFile)
-	readMedia(mediaFile)
+func setup(userRatingsFile, criticsFile, criticsRatingDir, mediaFile string) error {
+	if err := readUserRatings(userRatingsFile); err != nil {
+		return err
+	}
+	if err := readCritics(criticsFile); err != nil {
+		return err
+	}
+	if err := readMedia(mediaFile); err != nil {
+		return err
+	}
 
-	go readCriticsRatings(criticsRatingDir)
+	if _, err := os.Stat(criticsRatingDir); err != nil {
+		return fmt.Errorf("error reading critics dir %s: %w", criticsRatingDir, err)
+	}
+	criticsRatingsDir = criticsRatingDir
 
 	setupApp()
+	return nil
+}
+
+// Keeps the records read before a corrupt part of the file and remembers a warning to show.
+// Any other error (e.g. a missing file) is returned
+func keepReadable(file, what string, err error) error {
+	if !utils.IsCorrupt(err) {
+		return err
+	}
+	warning := fmt.Sprintf("Only the %s before the corrupt part of %s could be read: %v", what, file, err)
+	fmt.Fprintln(os.Stderr, warning)
+	loadWarnings = append(loadWarnings, warning)
+	return nil
 }
 
 func modal(p tview.Primitive, width, height int) tview.Primitive {
@@ -155,6 +214,12 @@ func setupApp() {
 	})
 
 	content.SetDirection(tview.FlexRow)
+	if len(loadWarnings) > 0 {
+		warnings := tview.NewTextView()
+		warnings.SetTextColor(tcell.ColorYellow)
+		warnings.SetText(strings.Join(loadWarnings, "\n"))
+		content.AddItem(warnings, len(loadWarnings), 0, false)
+	}
 	content.AddItem(mainSections, 0, 1, true)
 	content.AddItem(controls, 1, 0, false)
 
@@ -209,13 +274,43 @@ func spin(evaluationDone *bool, textView *tview.TextView) {
 	app.Draw()
 }
 
+// Shows the progress of the evaluation in a text view of the evaluation modal
+type headerReporter struct {
+	header      *tview.TextView
+	lastPercent int
+}
+
+func (r *headerReporter) show(p workqueue.Progress) {
+	r.header.Clear()
+	fmt.Fprintf(r.header, "%s: %d%%", p.Label, r.lastPercent)
+	app.Draw()
+}
+
+func (r *headerReporter) Start(p workqueue.Progress) {
+	r.lastPercent = 0
+	r.show(p)
+}
+
+func (r *headerReporter) Progress(p workqueue.Progress) {
+	if p.Total == 0 {
+		return
+	}
+	// redrawing for every critic would slow down the evaluation
+	if current := 100 * p.Done / p.Total; current > r.lastPercent {
+		r.lastPercent = current
+		r.show(p)
+	}
+}
+
+func (r *headerReporter) Finish(p workqueue.Progress, cancelled bool) {}
+
 // Displays evaluation modal and starts evaluation process
 func showEvalModal() {
 	evalModal.Clear()
 	header := tview.NewTextView()
 	header.SetBorderPadding(1, 1, 0, 0)
 	header.SetTextAlign(tview.AlignCenter)
-	header.SetText("Wait to read critics reviews")
+	header.SetText("Evaluating critics...")
 	evalModal.AddItem(header, 0, 1, false)
 	spinner := tview.NewTextView()
 	spinner.SetTextAlign(tview.AlignCenter)
@@ -225,29 +320,34 @@ func showEvalModal() {
 
 	layers.SwitchToPage(evalModalLabel)
 
-	if !criticRatingsAlreadyRead {
-		<-doneReadingcriticsRatings
-		criticRatingsAlreadyRead = true
-	}
-	header.Clear()
-	header.Write([]byte("Start Evaluation"))
-	app.Draw()
-	scoredCritics := evaluate(userRatings, criticsRatings, critics, workers)
+	var scoredCritics []ScoredCritic
+	scoredCritics, unreadableRatings = evaluate(selectedUserRatings(), criticsRatingsDir, critics, workers, &headerReporter{header: header})
 	evalDone = true
 
 	li := tview.NewList()
 	li.SetMouseCapture(nil)
 
-	const mainTemplate = "%04d: %s"
+	const mainTemplate = "%04d: %s%s"
 	const urlTemplate = `    Score: %.2f
     URL: https://www.rottentomatoes.com/critics/%s/movies`
 	for idx, critic := range scoredCritics {
-		mainTxt := fmt.Sprintf(mainTemplate, idx, critic.Critic.Name)
+		details := ""
+		if len(critic.Critic.Publications) > 0 {
+			details = fmt.Sprintf(" (%s)", strings.Join(critic.Critic.Publications, ", "))
+		}
+		mainTxt := fmt.Sprintf(mainTemplate, idx, critic.Critic.Name, details)
 		url := fmt.Sprintf(urlTemplate, critic.Score*100., critic.Critic.Url)
 		li.AddItem(mainTxt, url, ' ', nil)
 	}
 
 	evalModal.Clear()
+	if len(unreadableRatings) > 0 {
+		skipped := tview.NewTextView()
+		skipped.SetTextAlign(tview.AlignCenter)
+		skipped.SetTextColor(tcell.ColorYellow)
+		skipped.SetText(fmt.Sprintf("Skipped %d critics whose ratings couldn't be read (listed when quitting)", len(unreadableRatings)))
+		evalModal.AddItem(skipped, 1, 0, false)
+	}
 	evalModal.AddItem(li, 0, 1, true)
 
 	evalModal.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -375,62 +475,108 @@ func addRating() {
 	}
 
 	userRatings = append(userRatings, utils.NumericReview{
-		MediaUrl: selected.MediaUrl,
-		Score:    rating,
+		MediaUrl:  selected.MediaUrl,
+		Score:     rating,
+		MediaType: selected.MediaType.OrDefault(),
 	})
 
 }
 
-func readUserRatings(ratingsFile string) {
+func readUserRatings(ratingsFile string) error {
 	if _, err := os.Stat(ratingsFile); err != nil {
 		fmt.Printf("Creating empty ratingsFile, since %s doesn't exist...\nNo ratings so far.\n", ratingsFile)
-		if _, err := os.Create(ratingsFile); err != nil {
-			panic(err)
+		fo, err := os.Create(ratingsFile)
+		if err != nil {
+			return err
 		}
-		return
+		return fo.Close()
 	}
 	fmt.Printf("Reading user ratings from %s\n", ratingsFile)
-	readRatings := utils.ReadStructs[utils.NumericReview](ratingsFile, false)
+	readRatings, err := utils.ReadStructs[utils.NumericReview](ratingsFile, false)
+	if utils.IsCorrupt(err) {
+		// the file is overwritten with the readable part when quitting, so the original is kept next to it
+		backup := ratingsFile + ".corrupt"
+		if err := copyFile(ratingsFile, backup); err != nil {
+			return err
+		}
+		err = keepReadable(ratingsFile, "ratings", fmt.Errorf("%w (the original was copied to %s)", err, backup))
+	}
+	if err != nil {
+		return err
+	}
 	userRatings = append(userRatings, readRatings...)
 
 	fmt.Printf("Read user ratings. Have %d ratings now\n", len(userRatings))
 	showUserRatings()
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, content, 0644)
 }
 
-func readCritics(criticsFile string) {
+func readCritics(criticsFile string) error {
 	fmt.Println("Reading critics...")
-	critics = append(critics, utils.ReadStructs[utils.Critic](criticsFile, false)...)
+	allCritics, err := utils.ReadStructs[utils.Critic](criticsFile, false)
+	if err := keepReadable(criticsFile, "critics", err); err != nil {
+		return err
+	}
+	for _, critic := range allCritics {
+		if topCriticsOnly && !critic.TopCritic {
+			continue
+		}
+		if len(publications) > 0 && !critic.WritesFor(publications) {
+			continue
+		}
+		critics = append(critics, critic)
+	}
 	fmt.Printf("Read critics. Have %d critics now\n", len(critics))
+	return nil
 }
 
 func getAutocompleteVal(medium utils.Media) string {
+	if medium.ReleaseYear > 0 {
+		return fmt.Sprintf("%s [%d] (%s)", medium.MediaTitle, medium.ReleaseYear, medium.MediaUrl)
+	}
 	return fmt.Sprintf("%s (%s)", medium.MediaTitle, medium.MediaUrl)
 }
 
-func readMedia(mediaFile string) {
+func readMedia(mediaFile string) error {
 	fmt.Println("Reading media...")
-	media = append(media, utils.ReadStructs[utils.Media](mediaFile, false)...)
+	readMedia, err := utils.ReadStructs[utils.Media](mediaFile, false)
+	if err := keepReadable(mediaFile, "media", err); err != nil {
+		return err
+	}
+	media = append(media, readMedia...)
 	fmt.Printf("Read media. Have %d medias now\n", len(media))
+	var selectable []utils.Media
 	for _, medium := range media {
-		mediaNames = append(mediaNames, getAutocompleteVal(medium))
 		urlToMedia[medium.MediaUrl] = medium
+		if !utils.ContainsMediaType(mediaTypes, medium.MediaType) {
+			continue
+		}
+		selectable = append(selectable, medium)
+		mediaNames = append(mediaNames, getAutocompleteVal(medium))
 	}
+	media = selectable
+	return nil
 }
 
-func readCriticsRatings(ratingsDir string) {
-	entries, err := os.ReadDir(ratingsDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading critics dir %s:\n", ratingsDir)
-		panic(err)
-	}
-	for _, entry := range entries {
-		filePath := path.Join(ratingsDir, entry.Name())
-		criticUrl := strings.ReplaceAll(entry.Name(), ".gob", "")
-
-		reviews := utils.ReadStructs[utils.NumericReview](filePath, false)
-
-		criticsRatings[criticUrl] = reviews
+// Returns the user ratings of the media types selected for matching
+func selectedUserRatings() []utils.NumericReview {
+	var selectedRatings []utils.NumericReview
+	for _, rating := range userRatings {
+		mediaType := rating.MediaType
+		if medium, prs := urlToMedia[rating.MediaUrl]; prs && mediaType == "" {
+			mediaType = medium.MediaType
+		}
+		if utils.ContainsMediaType(mediaTypes, mediaType) {
+			selectedRatings = append(selectedRatings, rating)
+		}
 	}
-	doneReadingcriticsRatings <- true
-	criticRatingsAlreadyRead = true
+	return selectedRatings
 }
@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/MamfTheKramf/critics_finder/internal/utils"
+)
+
+// Writes the structs followed by garbage, so the file is corrupt after them
+func writeCorrupt[T fmt.Stringer](t *testing.T, structs []T, file string) {
+	if _, err := utils.WriteStructs(context.Background(), structs, file, false); err != nil {
+		t.Fatal(err)
+	}
+	fo, _ := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	fo.Write([]byte("garbage"))
+	fo.Close()
+}
+
+func TestReadCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	loadWarnings = nil
+	critics, media, userRatings = nil, nil, nil
+
+	writeCorrupt(t, []utils.Critic{{Url: "bob"}, {Url: "alice"}}, path.Join(dir, "critics.gob"))
+	writeCorrupt(t, []utils.Media{{MediaUrl: "/m/some_movie", MediaType: utils.MediaTypeMovie}}, path.Join(dir, "movies.gob"))
+	ratingsFile := path.Join(dir, "userRatings.gob")
+	writeCorrupt(t, []utils.NumericReview{{Score: 0.5, MediaUrl: "/m/some_movie"}}, ratingsFile)
+
+	if err := readCritics(path.Join(dir, "critics.gob")); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if err := readMedia(path.Join(dir, "movies.gob")); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if err := readUserRatings(ratingsFile); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if len(critics) != 2 || len(media) != 1 || len(userRatings) != 1 {
+		t.Errorf("Expected the readable records to be kept. Got %v, %v and %v", critics, media, userRatings)
+	}
+	if len(loadWarnings) != 3 {
+		t.Errorf("Expected 3 warnings. Got %v", loadWarnings)
+	}
+	if _, err := os.Stat(ratingsFile + ".corrupt"); err != nil {
+		t.Errorf("Expected a copy of the corrupt ratings file. Got %v", err)
+	}
+
+	// a missing file is still an error
+	if err := readCritics(path.Join(dir, "missing.gob")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
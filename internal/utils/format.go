@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Every file written by WriteStructs starts with these bytes, followed by a gob encoded FileHeader and the records.
+// A gob stream never starts with a zero byte, so files written before the header existed can be told apart.
+var fileMagic = []byte("\x00CFDS")
+
+// Schema version assumed for files without a header.
+// Those may actually have any layout up to the one of the version the header was introduced in,
+// so all migrations have to leave records alone that already have the newer layout.
+const LegacySchemaVersion = 1
+
+// Current schema version of each record type. Version 1 is the layout of the first release (the files in fallback.zip).
+// Bump the version whenever a field is added, removed or changes its meaning and add a migration to migrations if old records need fixing up.
+var SchemaVersions = map[string]int{
+	// 2: Publications, TopCritic, TomatometerApproved, ReviewCount
+	"Critic": 2,
+	// 2: MediaType; 3: Date, Publication, Sentiment, Quote, ReviewUrl
+	"Review": 3,
+	// 2: MediaType
+	"NumericReview": 2,
+	// 2: MediaType; 3: MediaMetadata
+	"Media": 3,
+}
+
+// Upgrades a record (a pointer to it) of the given record type from the version it's keyed with to the next one.
+// Fields that didn't exist in the old version are already zero, so only the ones that need a different value have to be set.
+var migrations = map[string]map[int]func(record any){
+	"Review": {
+		1: func(record any) {
+			r := record.(*Review)
+			r.MediaType = r.MediaType.OrDefault()
+		},
+	},
+	"NumericReview": {
+		1: func(record any) {
+			r := record.(*NumericReview)
+			r.MediaType = r.MediaType.OrDefault()
+		},
+	},
+	"Media": {
+		1: func(record any) {
+			m := record.(*Media)
+			m.MediaType = m.MediaType.OrDefault()
+		},
+	},
+}
+
+// Describes the content of a file written by WriteStructs
+type FileHeader struct {
+	// Name of the type of the records, e.g. "Review"
+	RecordType    string
+	SchemaVersion int
+	// When the data was written (for migrated files: when the original file was written)
+	Created time.Time
+	// Command and version of the program that wrote the data
+	CreatedBy string
+	// Set if the file was upgraded by 'migrate': when, and from which version
+	Migrated     time.Time
+	MigratedFrom int
+}
+
+func (h FileHeader) String() string {
+	s := fmt.Sprintf("%s v%d, created %s by %s", h.RecordType, h.SchemaVersion, h.Created.Format(time.RFC3339), h.CreatedBy)
+	if !h.Migrated.IsZero() {
+		s += fmt.Sprintf(", migrated from v%d on %s", h.MigratedFrom, h.Migrated.Format(time.RFC3339))
+	}
+	return s
+}
+
+// Returns the name of the record type T (without pointers), as it's stored in the file header
+func RecordTypeOf[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// Creates the header for a file with records of type T written right now
+func newFileHeader[T any]() FileHeader {
+	recordType := RecordTypeOf[T]()
+	return FileHeader{
+		RecordType:    recordType,
+		SchemaVersion: SchemaVersions[recordType],
+		Created:       time.Now(),
+		CreatedBy:     creator(),
+	}
+}
+
+// Returns the subcommand and version of the running program, e.g. "critics_finder fetch all-reviews (v1.2.0)"
+func creator() string {
+	command := []string{path.Base(os.Args[0])}
+	for _, arg := range os.Args[1:] {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		command = append(command, arg)
+	}
+
+	version := "unknown version"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				version = setting.Value
+			}
+		}
+	}
+	return fmt.Sprintf("%s (%s)", strings.Join(command, " "), version)
+}
+
+// Writes the magic bytes and the header. The records have to be written with the same encoder afterwards
+func writeFileHeader(w io.Writer, header FileHeader) (*gob.Encoder, error) {
+	if _, err := w.Write(fileMagic); err != nil {
+		return nil, err
+	}
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// Counts the bytes the gob decoder consumed, so errors can tell where in the file they happened
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// The gob decoder only reads exactly what it needs from an io.ByteReader instead of buffering on its own
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// Decodes the records following the header of a file
+type structReader struct {
+	file    string
+	dec     *gob.Decoder
+	counter *countingReader
+	header  FileHeader
+	// false for files written before there were headers
+	hasHeader bool
+	// number of records decoded so far
+	records int
+}
+
+// Reads the header from r (which was opened from file) and returns the reader for the records following it.
+// For files without a header, the header only has the legacy schema version set.
+func newStructReader(r io.Reader, file string) (*structReader, error) {
+	counter := &countingReader{r: bufio.NewReader(r)}
+	sr := &structReader{file: file, counter: counter, header: FileHeader{SchemaVersion: LegacySchemaVersion}}
+
+	magic, err := counter.r.Peek(len(fileMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, fileMagic) {
+		sr.dec = gob.NewDecoder(counter)
+		return sr, nil
+	}
+
+	discarded, _ := counter.r.Discard(len(fileMagic))
+	counter.n = int64(discarded)
+	sr.dec = gob.NewDecoder(counter)
+	sr.hasHeader = true
+	var header FileHeader
+	if err := sr.dec.Decode(&header); err != nil {
+		return nil, &CorruptFileError{File: file, Offset: counter.n, Err: fmt.Errorf("invalid file header: %w", err)}
+	}
+	sr.header = header
+	return sr, nil
+}
+
+// Decodes the next record into s. Returns io.EOF at the end of the file and a *CorruptFileError if the record can't be decoded.
+// Once the stream is corrupt, nothing after it can be decoded, so the reader mustn't be used afterwards.
+func (sr *structReader) next(s any) error {
+	offset := sr.counter.n
+	err := sr.dec.Decode(s)
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		return &CorruptFileError{File: sr.file, Offset: offset, Record: sr.records, Err: err}
+	}
+	sr.records++
+	return nil
+}
+
+// Returned if a file can't be decoded (any further)
+type CorruptFileError struct {
+	File string
+	// Position of the header or record that couldn't be decoded in bytes from the start of the file
+	Offset int64
+	// Number of records decoded successfully before
+	Record int
+	Err    error
+}
+
+func (e *CorruptFileError) Error() string {
+	return fmt.Sprintf("%s is corrupt at byte %d (after %d records): %v", e.File, e.Offset, e.Record, e.Err)
+}
+
+func (e *CorruptFileError) Unwrap() error {
+	return e.Err
+}
+
+// Reads the header of the given file. The returned bool is false for files written before there were headers
+func ReadFileHeader(filePath string) (FileHeader, bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return FileHeader{}, false, err
+	}
+	defer file.Close()
+
+	sr, err := newStructReader(file, filePath)
+	if err != nil {
+		return FileHeader{}, false, err
+	}
+	return sr.header, sr.hasHeader, nil
+}
+
+// Checks that records of type T can be read from a file with the given header and returns the function upgrading them
+// to the current schema version (nil if they already have it)
+func upgradeFor[T any](header FileHeader) (func(*T), error) {
+	recordType := RecordTypeOf[T]()
+	if header.RecordType != "" && header.RecordType != recordType {
+		return nil, fmt.Errorf("file contains %s records, not %s", header.RecordType, recordType)
+	}
+	current := SchemaVersions[recordType]
+	if header.SchemaVersion > current {
+		return nil, fmt.Errorf("file has version %d of %s, but this program only knows up to version %d. Please update critics_finder", header.SchemaVersion, recordType, current)
+	}
+
+	var steps []func(any)
+	for version := header.SchemaVersion; version < current; version++ {
+		if step, ok := migrations[recordType][version]; ok {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+
+	return func(s *T) {
+		// migrations work on pointers to the records, no matter if T is the record or a pointer to it
+		record := reflect.ValueOf(s).Elem()
+		if record.Kind() == reflect.Pointer {
+			if record.IsNil() {
+				return
+			}
+		} else {
+			record = record.Addr()
+		}
+		for _, step := range steps {
+			step(record.Interface())
+		}
+	}, nil
+}
+
+// Guesses the record type of a file without a header from the type definitions at the start of the gob stream.
+// Returns an empty string if it's none of the known types.
+func GuessRecordType(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	start := make([]byte, 256)
+	n, err := io.ReadFull(file, start)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	start = start[:n]
+
+	// gob defines the type of the first record first, with its name prefixed by its length
+	guess, guessPos := "", len(start)
+	for recordType := range SchemaVersions {
+		pos := bytes.Index(start, append([]byte{byte(len(recordType))}, recordType...))
+		if pos >= 0 && pos < guessPos {
+			guess, guessPos = recordType, pos
+		}
+	}
+	return guess, nil
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"path"
+	"testing"
+)
+
+// Writes the reviews like the first release did: a bare gob stream of the original layout
+func writeLegacyReviews(t *testing.T, fileName string) {
+	type Review struct {
+		Score      string
+		MediaTitle string
+		MediaInfo  string
+		MediaUrl   string
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatalf("Can't create legacy file: %v", err)
+	}
+	defer f.Close()
+	enc := gob.NewEncoder(f)
+	for _, r := range []Review{{"4/5", "Some Movie", "2001", "/m/some_movie"}, {"B+", "Other Movie", "2002", "/m/other_movie"}} {
+		if err := enc.Encode(r); err != nil {
+			t.Fatalf("Can't write legacy review: %v", err)
+		}
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "reviews.gob")
+	WriteStructs(context.Background(), []*Review{{Score: "4/5", MediaUrl: "/m/some_movie", MediaType: MediaTypeTv}}, fileName, false)
+
+	header, ok, err := ReadFileHeader(fileName)
+	if err != nil || !ok {
+		t.Fatalf("Expected a header. Got %v, %v", ok, err)
+	}
+	if header.RecordType != "Review" || header.SchemaVersion != SchemaVersions["Review"] || header.Created.IsZero() || header.CreatedBy == "" {
+		t.Errorf("Unexpected header %v", header)
+	}
+
+	reviews, err := ReadStructs[Review](fileName, false)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if len(reviews) != 1 || reviews[0].MediaType != MediaTypeTv {
+		t.Errorf("Expected the review to be read back unchanged. Got %v", reviews)
+	}
+}
+
+func TestReadLegacyFile(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "alice.gob")
+	writeLegacyReviews(t, fileName)
+
+	if _, ok, err := ReadFileHeader(fileName); ok || err != nil {
+		t.Fatalf("Expected no header. Got %v, %v", ok, err)
+	}
+	if guess, _ := GuessRecordType(fileName); guess != "Review" {
+		t.Errorf("Expected the record type to be guessed as Review. Got '%s'", guess)
+	}
+
+	reviews, err := ReadStructs[*Review](fileName, false)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if len(reviews) != 2 {
+		t.Fatalf("Expected 2 reviews. Got %d", len(reviews))
+	}
+	if reviews[1].Score != "B+" || reviews[1].MediaType != MediaTypeMovie {
+		t.Errorf("Expected the legacy review to be migrated. Got %v", *reviews[1])
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "alice.gob")
+	writeLegacyReviews(t, fileName)
+
+	old, err := MigrateFile[Review](fileName)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if old.SchemaVersion != LegacySchemaVersion {
+		t.Errorf("Expected the old header to have the legacy version. Got %v", old)
+	}
+
+	header, ok, err := ReadFileHeader(fileName)
+	if err != nil || !ok {
+		t.Fatalf("Expected the migrated file to have a header. Got %v, %v", ok, err)
+	}
+	if header.SchemaVersion != SchemaVersions["Review"] || header.MigratedFrom != LegacySchemaVersion || header.Migrated.IsZero() {
+		t.Errorf("Unexpected header of migrated file %v", header)
+	}
+	reviews, err := ReadStructs[Review](fileName, false)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if len(reviews) != 2 || reviews[0].MediaTitle != "Some Movie" || reviews[0].MediaType != MediaTypeMovie {
+		t.Errorf("Unexpected migrated reviews %v", reviews)
+	}
+
+	// migrating again doesn't change anything
+	if _, err := MigrateFile[Review](fileName); err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	again, _, _ := ReadFileHeader(fileName)
+	if !again.Migrated.Equal(header.Migrated) {
+		t.Errorf("Expected an up to date file to be left alone. Got %v", again)
+	}
+}
+
+func TestReadStructsRejectsForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	criticsFile := path.Join(dir, "critics.gob")
+	WriteStructs(context.Background(), []Critic{{Name: "Hutzi", Url: "Butzi"}}, criticsFile, false)
+	if _, _, err := readStructs[Review](criticsFile, false); err == nil {
+		t.Errorf("Expected reading critics as reviews to fail")
+	}
+
+	newerFile := path.Join(dir, "newer.gob")
+	f, _ := os.Create(newerFile)
+	header := newFileHeader[Critic]()
+	header.SchemaVersion++
+	writeFileHeader(f, header)
+	f.Close()
+	if _, _, err := readStructs[Critic](newerFile, false); err == nil {
+		t.Errorf("Expected reading a file of a newer version to fail")
+	}
+}
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// A temporary file next to a target file that replaces the target once it's committed.
+// Readers of the target never see a partially written file.
+type AtomicFile struct {
+	*os.File
+	target string
+}
+
+// Creates a temporary file that replaces outFile when it's committed
+func CreateAtomic(outFile string) (*AtomicFile, error) {
+	fo, err := os.CreateTemp(path.Dir(outFile), path.Base(outFile)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: fo, target: outFile}, nil
+}
+
+// Moves the written file into place. It gets the permissions of the file it replaces (0644 for new files),
+// since temporary files are only readable by their owner.
+func (f *AtomicFile) Commit() error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(f.target); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.target); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Removes the temporary file and leaves the target as it was
+func (f *AtomicFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// Writes the structs into outFile and returns how many were written.
+// The structs are written to a temporary file first which then replaces outFile, so a crash or an error never leaves a half-written file behind.
+// If ctx is cancelled or a struct can't be encoded, the write is rolled back (outFile stays as it was) and the error is returned.
+// The file starts with a FileHeader describing the records (see format.go).
+func WriteStructs[T fmt.Stringer](ctx context.Context, structs []T, outFile string, verbose bool) (int, error) {
+	return writeStructs(ctx, newFileHeader[T](), structs, outFile, verbose)
+}
+
+func writeStructs[T fmt.Stringer](ctx context.Context, header FileHeader, structs []T, outFile string, verbose bool) (int, error) {
+	w, err := createStructs[T](header, outFile)
+	if err != nil {
+		return 0, err
+	}
+
+	for idx, s := range structs {
+		if ctx.Err() != nil {
+			if verbose {
+				fmt.Println("\rWriting to file: cancelled")
+			}
+			w.Abort()
+			return 0, ctx.Err()
+		}
+		if verbose && idx%10 == 0 {
+			fmt.Printf("\rWriting to file: %.2f%%", float32(idx)/float32(len(structs)))
+		}
+
+		if err := w.Write(s); err != nil {
+			w.Abort()
+			return 0, err
+		}
+	}
+	if verbose {
+		fmt.Println("\r Writing to file: 100%")
+	}
+
+	return w.Commit()
+}
+
+// Writes structs into a file one at a time, so they don't have to be in memory at once.
+// Like with WriteStructs, outFile is only replaced once all of them were written. Create it with CreateStructs
+type StructWriter[T fmt.Stringer] struct {
+	file    *AtomicFile
+	enc     *gob.Encoder
+	written int
+}
+
+// Starts writing structs to a temporary file that replaces outFile on Commit
+func CreateStructs[T fmt.Stringer](outFile string) (*StructWriter[T], error) {
+	return createStructs[T](newFileHeader[T](), outFile)
+}
+
+func createStructs[T fmt.Stringer](header FileHeader, outFile string) (*StructWriter[T], error) {
+	file, err := CreateAtomic(outFile)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := writeFileHeader(file, header)
+	if err != nil {
+		file.Abort()
+		return nil, fmt.Errorf("couldn't write header of %s: %w", outFile, err)
+	}
+	return &StructWriter[T]{file: file, enc: enc}, nil
+}
+
+func (w *StructWriter[T]) Write(s T) error {
+	if err := w.enc.Encode(s); err != nil {
+		return fmt.Errorf("couldn't write struct %d (%s) to %s: %w", w.written, s.String(), w.file.target, err)
+	}
+	w.written++
+	return nil
+}
+
+// Replaces outFile with the written structs and returns how many there are
+func (w *StructWriter[T]) Commit() (int, error) {
+	if err := w.file.Commit(); err != nil {
+		return 0, err
+	}
+	return w.written, nil
+}
+
+// Discards the written structs and leaves outFile as it was
+func (w *StructWriter[T]) Abort() {
+	w.file.Abort()
+}
+
+// Reads all the structs from a given file. Records written with an older schema version are migrated to the current one.
+// If the file is corrupt, reading stops there and the structs read so far are returned together with a *CorruptFileError.
+// Use EachStruct or OpenStructs for files that don't need to be in memory as a whole.
+func ReadStructs[T any](filePath string, verbose bool) ([]T, error) {
+	structs, _, err := readStructs[T](filePath, verbose)
+	return structs, err
+}
+
+// Reads the structs and the header of the file
+func readStructs[T any](filePath string, verbose bool) ([]T, FileHeader, error) {
+	if verbose {
+		fmt.Println("Scanning structs file...")
+	}
+
+	var structs []T
+	header, err := eachStruct(filePath, func(s T) error {
+		structs = append(structs, s)
+		return nil
+	})
+
+	if verbose && err == nil {
+		fmt.Printf("Found %d structs\n", len(structs))
+	}
+	return structs, header, err
+}
+
+// Calls fn for every struct in the file, one at a time, so only one of them has to be in memory.
+// Stops at the first error returned by fn and returns it. Corrupt files are reported like by ReadStructs,
+// after fn was called for every struct before the corrupt one.
+func EachStruct[T any](filePath string, fn func(T) error) error {
+	_, err := eachStruct(filePath, fn)
+	return err
+}
+
+func eachStruct[T any](filePath string, fn func(T) error) (FileHeader, error) {
+	reader, err := OpenStructs[T](filePath)
+	if err != nil {
+		return FileHeader{}, err
+	}
+	defer reader.Close()
+
+	for {
+		s, err := reader.Next()
+		if err == io.EOF {
+			return reader.Header(), nil
+		}
+		if err != nil {
+			return reader.Header(), err
+		}
+		if err := fn(s); err != nil {
+			return reader.Header(), err
+		}
+	}
+}
+
+// Reads the structs of a file one at a time. Create it with OpenStructs and close it when done
+type StructReader[T any] struct {
+	file    *os.File
+	reader  *structReader
+	upgrade func(*T)
+	// sticks once the file turned out to be corrupt
+	err error
+}
+
+// Opens the file for reading its structs one at a time. Fails if the file can't be opened,
+// its header is broken or it doesn't contain structs of type T (in a version known to this program)
+func OpenStructs[T any](filePath string) (*StructReader[T], error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := newStructReader(file, filePath)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	upgrade, err := upgradeFor[T](reader.header)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	return &StructReader[T]{file: file, reader: reader, upgrade: upgrade}, nil
+}
+
+// Returns the header of the file (see ReadFileHeader for files without one)
+func (r *StructReader[T]) Header() FileHeader {
+	return r.reader.header
+}
+
+// Returns the next struct, migrated to the current schema version.
+// Returns io.EOF after the last one and a *CorruptFileError (again on every further call) if the file is corrupt.
+func (r *StructReader[T]) Next() (T, error) {
+	var s T
+	if r.err != nil {
+		return s, r.err
+	}
+	if err := r.reader.next(&s); err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return s, err
+	}
+	if r.upgrade != nil {
+		r.upgrade(&s)
+	}
+	return s, nil
+}
+
+func (r *StructReader[T]) Close() error {
+	return r.file.Close()
+}
+
+// Returns whether err means that a file is corrupt (rather than e.g. missing)
+func IsCorrupt(err error) bool {
+	var corruptErr *CorruptFileError
+	return errors.As(err, &corruptErr)
+}
+
+// Upgrades the file to the current schema version of T in place and returns the header it had before.
+// Files that already have the current version are left untouched. If the file is corrupt, it isn't changed either.
+func MigrateFile[T fmt.Stringer](filePath string) (FileHeader, error) {
+	old, hasHeader, err := ReadFileHeader(filePath)
+	if err != nil {
+		return old, err
+	}
+	recordType := RecordTypeOf[T]()
+	if hasHeader && old.RecordType == recordType && old.SchemaVersion == SchemaVersions[recordType] {
+		return old, nil
+	}
+
+	structs, old, err := readStructs[T](filePath, false)
+	if err != nil {
+		return old, err
+	}
+
+	header := newFileHeader[T]()
+	header.Migrated = header.Created
+	header.MigratedFrom = old.SchemaVersion
+	if hasHeader {
+		header.Created = old.Created
+		header.CreatedBy = old.CreatedBy
+	} else {
+		// the best guess we have for when legacy files were written
+		header.CreatedBy = "unknown (file without header)"
+		if info, err := os.Stat(filePath); err == nil {
+			header.Created = info.ModTime()
+		}
+	}
+
+	_, err = writeStructs(context.Background(), header, structs, filePath, false)
+	return old, err
+}
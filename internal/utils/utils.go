@@ -1,11 +1,12 @@
 package utils
 
 import (
-	"encoding/gob"
+	"context"
 	"fmt"
-	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"time"
 )
 
 const (
@@ -43,121 +44,187 @@ func Remove[T any](arr []T, idx uint) ([]T, error) {
 	return ret, nil
 }
 
+// Returns a context that is cancelled by the first Ctrl+C, so a command can stop gracefully.
+// A second Ctrl+C kills the process. Call stop once the command is done
+func InterruptContext() (ctx context.Context, stop context.CancelFunc) {
+	ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		// with the handler gone, the next Ctrl+C gets the default behavior
+		stop()
+	}()
+	return ctx, stop
+}
+
 type Critic struct {
 	Name string
 	Url  string
+	// The fields below are only set after the critic's profile was fetched
+	Publications        []string
+	TopCritic           bool
+	TomatometerApproved bool
+	// Total number of reviews according to the profile
+	ReviewCount int
 }
 
 func (c Critic) String() string {
-	return fmt.Sprintf("%s, %s", c.Name, c.Url)
-}
-
-func WriteStructs[T fmt.Stringer](structs []T, outFile string, verbose bool) int {
-	fo, err := os.Create(outFile)
-	if err != nil {
-		panic(err)
+	if len(c.Publications) == 0 && !c.TopCritic && !c.TomatometerApproved && c.ReviewCount == 0 {
+		return fmt.Sprintf("%s, %s", c.Name, c.Url)
 	}
-	defer fo.Close()
-
-	enc := gob.NewEncoder(fo)
-
-	writtenStructs := 0
-	for idx, s := range structs {
-		if verbose && idx%10 == 0 {
-			fmt.Printf("\rWriting to file: %.2f%%", float32(idx)/float32(len(structs)))
-		}
+	return fmt.Sprintf("%s, %s, [%s], top critic: %t, approved: %t, %d reviews",
+		c.Name, c.Url, strings.Join(c.Publications, "; "), c.TopCritic, c.TomatometerApproved, c.ReviewCount)
+}
 
-		err := enc.Encode(s)
-		if err != nil {
-			if verbose {
-				fmt.Printf("\rCouldn't write struct %s\n", s.String())
+// Returns whether the critic writes for a publication containing one of the given names (case insensitive)
+func (c Critic) WritesFor(publications []string) bool {
+	for _, own := range c.Publications {
+		for _, wanted := range publications {
+			if strings.Contains(strings.ToLower(own), strings.ToLower(strings.TrimSpace(wanted))) {
+				return true
 			}
-			continue
 		}
-
-		writtenStructs++
 	}
-	if verbose {
-		fmt.Println("\r Writing to file: 100%")
-	}
-
-	return writtenStructs
+	return false
 }
 
-// Reads all the critics from a given file
-func ReadStructs[T any](filePath string, verbose bool) []T {
-	inFile, err := os.Open(filePath)
-	if err != nil {
-		panic(err)
-	}
-	defer inFile.Close()
+// Kind of media a review is about
+type MediaType string
 
-	dec := gob.NewDecoder(inFile)
+const (
+	MediaTypeMovie MediaType = "movie"
+	MediaTypeTv    MediaType = "tv"
+)
 
-	var structs []T
-	var skippedStructs = 0
+// All media types in the order they are fetched
+var MediaTypes = []MediaType{MediaTypeMovie, MediaTypeTv}
 
-	if verbose {
-		fmt.Println("Scanning structs file...")
+// Returns the media type, treating the empty type of data written before TV reviews were fetched as movie
+func (t MediaType) OrDefault() MediaType {
+	if t == "" {
+		return MediaTypeMovie
 	}
-	for {
-		var s T
-		err := dec.Decode(&s)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			skippedStructs++
-			continue
-		}
+	return t
+}
 
-		structs = append(structs, s)
+// Parses a media selection given on the command line ("movie", "tv" or "all") into the selected media types
+func ParseMediaTypes(selection string) ([]MediaType, error) {
+	switch selection {
+	case "all":
+		return MediaTypes, nil
+	case string(MediaTypeMovie), string(MediaTypeTv):
+		return []MediaType{MediaType(selection)}, nil
 	}
+	return nil, fmt.Errorf("unknown media selection '%s'. Expected one of 'movie', 'tv' or 'all'", selection)
+}
 
-	if verbose {
-		fmt.Printf("Found %d structs\n", len(structs))
-		fmt.Printf("Skipped %d structs\n", skippedStructs)
+// Returns whether t is one of the given media types
+func ContainsMediaType(types []MediaType, t MediaType) bool {
+	t = t.OrDefault()
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
 	}
-
-	return structs
+	return false
 }
 
+// Whether a review was counted as positive (fresh) or negative (rotten) for the Tomatometer
+type Sentiment string
+
+const (
+	SentimentFresh  Sentiment = "fresh"
+	SentimentRotten Sentiment = "rotten"
+)
+
 type Review struct {
 	Score      string
 	MediaTitle string
 	MediaInfo  string
 	MediaUrl   string
+	MediaType  MediaType
+	// When the review was published (zero if unknown)
+	Date        time.Time
+	Publication string
+	// Empty if unknown
+	Sentiment Sentiment
+	// Short excerpt of the review
+	Quote string
+	// Link to the full review on the publication's site
+	ReviewUrl string
 }
 
 func (r Review) String() string {
-	return fmt.Sprintf("%s;%s;%s;%s",
+	date := ""
+	if !r.Date.IsZero() {
+		date = r.Date.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s;%s;%s;%s;%s;%s;%s;%s;%s;%s",
 		strings.ReplaceAll(r.Score, ";", "\\;"),
 		strings.ReplaceAll(r.MediaTitle, ";", "\\;"),
 		strings.ReplaceAll(r.MediaInfo, ";", "\\;"),
-		strings.ReplaceAll(r.MediaUrl, ";", "\\;"))
+		strings.ReplaceAll(r.MediaUrl, ";", "\\;"),
+		r.MediaType.OrDefault(),
+		date,
+		strings.ReplaceAll(r.Publication, ";", "\\;"),
+		r.Sentiment,
+		strings.ReplaceAll(r.Quote, ";", "\\;"),
+		strings.ReplaceAll(r.ReviewUrl, ";", "\\;"))
 }
 
 type NumericReview struct {
-	Score    float32
-	MediaUrl string
+	Score     float32
+	MediaUrl  string
+	MediaType MediaType
 }
 
 func (r NumericReview) String() string {
-	return fmt.Sprintf("%f;%s",
+	return fmt.Sprintf("%f;%s;%s",
 		r.Score,
-		strings.ReplaceAll(r.MediaUrl, ";", "\\;"))
+		strings.ReplaceAll(r.MediaUrl, ";", "\\;"),
+		r.MediaType.OrDefault())
 }
 
 type Media struct {
 	MediaTitle string
 	MediaInfo  string
 	MediaUrl   string
+	MediaType  MediaType
+	MediaMetadata
+}
+
+// Details about a medium fetched from its own page (see 'fetch media')
+type MediaMetadata struct {
+	// Whether the fields below were fetched at all
+	MetadataFetched bool
+	// 0 if unknown
+	ReleaseYear int
+	Genres      []string
+	// 0 if unknown
+	RuntimeMinutes int
+	// Content rating like "PG-13" (empty if unknown)
+	Rating string
+	// Percentages from 0 to 100. -1 if unknown
+	TomatometerScore int
+	AudienceScore    int
 }
 
 func (m Media) String() string {
-	return fmt.Sprintf("%s;%s;%s",
+	if !m.MetadataFetched {
+		return fmt.Sprintf("%s;%s;%s;%s",
+			strings.ReplaceAll(m.MediaTitle, ";", "\\;"),
+			strings.ReplaceAll(m.MediaInfo, ";", "\\;"),
+			strings.ReplaceAll(m.MediaUrl, ";", "\\;"),
+			m.MediaType.OrDefault())
+	}
+	return fmt.Sprintf("%s;%s;%s;%s;%d;%s;%d;%s;%d;%d",
 		strings.ReplaceAll(m.MediaTitle, ";", "\\;"),
 		strings.ReplaceAll(m.MediaInfo, ";", "\\;"),
-		strings.ReplaceAll(m.MediaUrl, ";", "\\;"))
+		strings.ReplaceAll(m.MediaUrl, ";", "\\;"),
+		m.MediaType.OrDefault(),
+		m.ReleaseYear,
+		strings.ReplaceAll(strings.Join(m.Genres, "/"), ";", "\\;"),
+		m.RuntimeMinutes,
+		strings.ReplaceAll(m.Rating, ";", "\\;"),
+		m.TomatometerScore,
+		m.AudienceScore)
 }
@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"testing"
 )
 
@@ -32,9 +37,14 @@ func TestSerDe(t *testing.T) {
 	}
 	defer os.Remove(f.Name())
 
-	WriteStructs(expectedCriritcs, f.Name(), false)
+	if _, err := WriteStructs(context.Background(), expectedCriritcs, f.Name(), false); err != nil {
+		t.Fatalf("Can't write critics: %v", err)
+	}
 
-	critics := ReadStructs[Critic](f.Name(), false)
+	critics, err := ReadStructs[Critic](f.Name(), false)
+	if err != nil {
+		t.Fatalf("Can't read critics: %v", err)
+	}
 
 	if len(critics) != len(expectedCriritcs) {
 		t.Fatalf("Expected %d critics. Got %d", len(expectedCriritcs), len(critics))
@@ -48,6 +58,27 @@ func TestSerDe(t *testing.T) {
 	}
 }
 
+func TestWriteStructsCancelled(t *testing.T) {
+	dir := t.TempDir()
+	fileName := path.Join(dir, "critics.gob")
+	WriteStructs(context.Background(), []Critic{{Name: "Hutzi", Url: "Butzi"}}, fileName, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if written, err := WriteStructs(ctx, []Critic{{Name: "Butzi", Url: "Hutzi"}, {Name: "Other", Url: "Other"}}, fileName, false); written != 0 || err != context.Canceled {
+		t.Errorf("Expected cancelled write to write nothing. Wrote %d, error %v", written, err)
+	}
+
+	critics, _ := ReadStructs[Critic](fileName, false)
+	if len(critics) != 1 || critics[0].Name != "Hutzi" {
+		t.Errorf("Expected the old file to be kept. Got %v", critics)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed. Got %v", entries)
+	}
+}
+
 func arrComp(t *testing.T, expected, actual []int) {
 	if len(expected) != len(actual) {
 		t.Errorf("expected: %v\ngot: %v", expected, actual)
@@ -86,3 +117,137 @@ func TestRemove(t *testing.T) {
 		t.Errorf("expected error but got %v", actual)
 	}
 }
+
+func TestParseMediaTypes(t *testing.T) {
+	all, err := ParseMediaTypes("all")
+	if err != nil || len(all) != 2 {
+		t.Errorf("expected both media types for 'all' but got %v (%v)", all, err)
+	}
+
+	tv, err := ParseMediaTypes("tv")
+	if err != nil || len(tv) != 1 || tv[0] != MediaTypeTv {
+		t.Errorf("expected only tv but got %v (%v)", tv, err)
+	}
+
+	if _, err := ParseMediaTypes("books"); err == nil {
+		t.Errorf("expected error for unknown media selection")
+	}
+
+	// data written before TV reviews existed has no media type and counts as movie
+	if !ContainsMediaType([]MediaType{MediaTypeMovie}, "") {
+		t.Errorf("expected empty media type to count as movie")
+	}
+	if ContainsMediaType([]MediaType{MediaTypeTv}, "") {
+		t.Errorf("expected empty media type not to count as tv")
+	}
+}
+
+func TestReadStructsCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	fileName := path.Join(dir, "critics.gob")
+	if _, err := ReadStructs[Critic](fileName, false); err == nil || IsCorrupt(err) {
+		t.Errorf("Expected a missing file to be reported as such. Got %v", err)
+	}
+
+	WriteStructs(context.Background(), []Critic{{Name: "Hutzi", Url: "Butzi"}, {Name: "Butzi", Url: "Hutzi"}}, fileName, false)
+	content, _ := os.ReadFile(fileName)
+
+	// cut off the last record
+	os.WriteFile(fileName, content[:len(content)-3], 0644)
+	critics, err := ReadStructs[Critic](fileName, false)
+	var corruptErr *CorruptFileError
+	if !errors.As(err, &corruptErr) {
+		t.Fatalf("Expected a *CorruptFileError. Got %v", err)
+	}
+	if corruptErr.Record != 1 || corruptErr.Offset <= 0 || corruptErr.Offset >= int64(len(content)) {
+		t.Errorf("Expected the error to point at the second record. Got %v", corruptErr)
+	}
+	if len(critics) != 1 || critics[0].Name != "Hutzi" {
+		t.Errorf("Expected the first critic to be read anyway. Got %v", critics)
+	}
+
+	// garbage after the header must not make the reader spin
+	os.WriteFile(fileName, append(content[:len(content)/2], bytes.Repeat([]byte{0xff}, 100)...), 0644)
+	if _, err := ReadStructs[Critic](fileName, false); !IsCorrupt(err) {
+		t.Errorf("Expected a corrupt file error. Got %v", err)
+	}
+}
+
+func TestStructReader(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "critics.gob")
+	WriteStructs(context.Background(), []Critic{{Name: "Hutzi", Url: "Butzi"}, {Name: "Butzi", Url: "Hutzi"}}, fileName, false)
+
+	reader, err := OpenStructs[Critic](fileName)
+	if err != nil {
+		t.Fatalf("Can't open critics: %v", err)
+	}
+	defer reader.Close()
+	if reader.Header().RecordType != "Critic" {
+		t.Errorf("Expected a header for critics. Got %v", reader.Header())
+	}
+	var names []string
+	for {
+		critic, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected no error. Got %v", err)
+		}
+		names = append(names, critic.Name)
+	}
+	if len(names) != 2 || names[0] != "Hutzi" || names[1] != "Butzi" {
+		t.Errorf("Expected both critics in order. Got %v", names)
+	}
+
+	if _, err := OpenStructs[Media](fileName); err == nil {
+		t.Errorf("Expected opening critics as media to fail")
+	}
+}
+
+func TestEachStruct(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "critics.gob")
+	WriteStructs(context.Background(), []Critic{{Name: "Hutzi"}, {Name: "Butzi"}, {Name: "Other"}}, fileName, false)
+
+	stop := errors.New("stop")
+	visited := 0
+	err := EachStruct(fileName, func(c Critic) error {
+		visited++
+		if c.Name == "Butzi" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visited != 2 {
+		t.Errorf("Expected to stop at the second critic. Visited %d, got %v", visited, err)
+	}
+
+	// the structs before a corrupt one are still visited
+	content, _ := os.ReadFile(fileName)
+	os.WriteFile(fileName, content[:len(content)-3], 0644)
+	visited = 0
+	err = EachStruct(fileName, func(c Critic) error {
+		visited++
+		return nil
+	})
+	if !IsCorrupt(err) || visited != 2 {
+		t.Errorf("Expected 2 critics and a corrupt file error. Visited %d, got %v", visited, err)
+	}
+}
+
+func TestWriteStructsMode(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "critics.gob")
+	critics := []Critic{{Name: "Hutzi", Url: "Butzi"}}
+
+	WriteStructs(context.Background(), critics, fileName, false)
+	if info, err := os.Stat(fileName); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected a new file to have mode 0644. Got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	// rewriting a file keeps its permissions
+	os.Chmod(fileName, 0640)
+	WriteStructs(context.Background(), critics, fileName, false)
+	if info, err := os.Stat(fileName); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the rewritten file to keep mode 0640. Got %v (%v)", info.Mode().Perm(), err)
+	}
+}
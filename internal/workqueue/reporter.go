@@ -0,0 +1,213 @@
+package workqueue
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Gets told about the progress of a Run. All methods are called from the goroutine that called Run
+type Reporter interface {
+	Start(p Progress)
+	// called after every finished job
+	Progress(p Progress)
+	// called once all jobs are done or the Run was cancelled
+	Finish(p Progress, cancelled bool)
+}
+
+type noReporter struct{}
+
+func (noReporter) Start(Progress)        {}
+func (noReporter) Progress(Progress)     {}
+func (noReporter) Finish(Progress, bool) {}
+
+// Reporter that doesn't report anything
+var None Reporter = noReporter{}
+
+func percent(p Progress) float64 {
+	if p.Total == 0 {
+		return 100
+	}
+	return 100 * float64(p.Done) / float64(p.Total)
+}
+
+// Progress bar that is redrawn in place. Meant for terminals
+type barReporter struct {
+	w        io.Writer
+	width    int
+	lastDraw time.Time
+}
+
+// Creates a Reporter drawing a progress bar to w
+func Bar(w io.Writer) Reporter {
+	return &barReporter{w: w, width: 30}
+}
+
+func (r *barReporter) draw(p Progress) {
+	filled := int(float64(r.width) * percent(p) / 100)
+	fmt.Fprintf(r.w, "\r%s [%s%s] %6.2f%% %d/%d; %d errors",
+		p.Label,
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", r.width-filled),
+		percent(p),
+		p.Done,
+		p.Total,
+		p.Failed)
+	r.lastDraw = time.Now()
+}
+
+func (r *barReporter) Start(p Progress) { r.draw(p) }
+
+func (r *barReporter) Progress(p Progress) {
+	// redrawing for every job would slow down quick jobs
+	if time.Since(r.lastDraw) >= 100*time.Millisecond {
+		r.draw(p)
+	}
+}
+
+func (r *barReporter) Finish(p Progress, cancelled bool) {
+	r.draw(p)
+	if cancelled {
+		fmt.Fprint(r.w, " (interrupted)")
+	}
+	fmt.Fprintln(r.w)
+}
+
+// Plain log lines for each percent of progress. Meant for log files
+type linesReporter struct {
+	w           io.Writer
+	lastPercent int
+}
+
+// Creates a Reporter writing a line to w every time another percent of the jobs is done
+func Lines(w io.Writer) Reporter {
+	return &linesReporter{w: w}
+}
+
+func (r *linesReporter) line(p Progress, status string) {
+	fmt.Fprintf(r.w, "%s: %s %.2f%% done; %d of %d; %d errors; %s elapsed\n",
+		p.Label,
+		status,
+		percent(p),
+		p.Done,
+		p.Total,
+		p.Failed,
+		p.Elapsed.Round(time.Second))
+}
+
+func (r *linesReporter) Start(p Progress) {
+	r.lastPercent = 0
+	r.line(p, "started;")
+}
+
+func (r *linesReporter) Progress(p Progress) {
+	if current := int(percent(p)); current > r.lastPercent {
+		r.lastPercent = current
+		r.line(p, "")
+	}
+}
+
+func (r *linesReporter) Finish(p Progress, cancelled bool) {
+	if cancelled {
+		r.line(p, "interrupted;")
+		return
+	}
+	r.line(p, "finished;")
+}
+
+// One JSON object per line for each event. Meant for other programs
+type jsonReporter struct {
+	enc *json.Encoder
+}
+
+// Event written by the JSON reporter
+type jsonEvent struct {
+	Event     string `json:"event"`
+	Label     string `json:"label"`
+	Total     int    `json:"total"`
+	Done      int    `json:"done"`
+	Failed    int    `json:"failed"`
+	ElapsedMs int64  `json:"elapsedMs"`
+}
+
+// Creates a Reporter writing a JSON object for each event to w.
+// The event is one of "start", "progress", "finish" and "cancel".
+func JSON(w io.Writer) Reporter {
+	return &jsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *jsonReporter) event(name string, p Progress) {
+	r.enc.Encode(jsonEvent{
+		Event:     name,
+		Label:     p.Label,
+		Total:     p.Total,
+		Done:      p.Done,
+		Failed:    p.Failed,
+		ElapsedMs: p.Elapsed.Milliseconds(),
+	})
+}
+
+func (r *jsonReporter) Start(p Progress)    { r.event("start", p) }
+func (r *jsonReporter) Progress(p Progress) { r.event("progress", p) }
+
+func (r *jsonReporter) Finish(p Progress, cancelled bool) {
+	if cancelled {
+		r.event("cancel", p)
+		return
+	}
+	r.event("finish", p)
+}
+
+// Returns whether w is a terminal (and not a file or a pipe)
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Names of the reporters accepted by NewReporter
+const (
+	REPORTER_AUTO  = "auto"
+	REPORTER_BAR   = "bar"
+	REPORTER_LINES = "lines"
+	REPORTER_JSON  = "json"
+	REPORTER_NONE  = "none"
+)
+
+// Creates the reporter with the given name writing to w.
+// "auto" is a progress bar if w is a terminal and log lines otherwise.
+func NewReporter(name string, w io.Writer) (Reporter, error) {
+	switch name {
+	case REPORTER_AUTO:
+		if isTerminal(w) {
+			return Bar(w), nil
+		}
+		return Lines(w), nil
+	case REPORTER_BAR:
+		return Bar(w), nil
+	case REPORTER_LINES:
+		return Lines(w), nil
+	case REPORTER_JSON:
+		return JSON(w), nil
+	case REPORTER_NONE:
+		return None, nil
+	}
+	return nil, fmt.Errorf("unknown progress reporter '%s' (expected %s, %s, %s, %s or %s)",
+		name, REPORTER_AUTO, REPORTER_BAR, REPORTER_LINES, REPORTER_JSON, REPORTER_NONE)
+}
+
+// Adds the -progress flag to the given flag set. The returned function creates the selected reporter writing to stderr
+// and has to be called after the flags were parsed.
+func AddFlag(set *flag.FlagSet) func() (Reporter, error) {
+	name := set.String("progress", REPORTER_AUTO, "How to report progress ('auto', 'bar', 'lines', 'json' or 'none')")
+	return func() (Reporter, error) {
+		return NewReporter(*name, os.Stderr)
+	}
+}
@@ -0,0 +1,104 @@
+// Runs jobs on a pool of workers and reports their progress
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// State of a Run that is passed to the Reporter
+type Progress struct {
+	Label string
+	// number of jobs
+	Total int
+	// number of finished jobs (successful or not)
+	Done int
+	// number of jobs that returned an error
+	Failed  int
+	Elapsed time.Duration
+}
+
+// Options of a Run
+type Options struct {
+	// number of jobs that run at the same time (at least 1)
+	Workers int
+	// describes the jobs in progress messages (e.g. "Fetching reviews")
+	Label string
+	// gets told about every finished job. Nothing is reported if nil
+	Reporter Reporter
+}
+
+// Calls job for every index in [0; count) using the given number of workers.
+// Indices are handed out one by one as soon as a worker is free, so a few slow jobs don't hold up the others.
+// Once ctx is cancelled, no further jobs are started and Run waits for the running ones.
+// Jobs that fail because of the cancellation (their error is ctx's error) count as neither done nor failed.
+// Returns the final progress and the errors of all failed jobs (in the order they finished).
+func Run(ctx context.Context, count int, opts Options, job func(ctx context.Context, idx int) error) (Progress, []error) {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	reporter := opts.Reporter
+	if reporter == nil {
+		reporter = None
+	}
+
+	start := time.Now()
+	progress := Progress{Label: opts.Label, Total: count}
+	reporter.Start(progress)
+
+	jobs := make(chan int)
+	results := make(chan error)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results <- job(ctx, idx)
+			}
+		}()
+	}
+
+	var errs []error
+	next := 0
+	running := 0
+	for next < count || running > 0 {
+		// stop handing out jobs once ctx is cancelled
+		var send chan<- int
+		var done <-chan struct{}
+		if next < count && ctx.Err() == nil {
+			send = jobs
+			done = ctx.Done()
+		} else if running == 0 {
+			break
+		}
+
+		select {
+		case send <- next:
+			next++
+			running++
+		case err := <-results:
+			running--
+			if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				continue
+			}
+			progress.Done++
+			if err != nil {
+				progress.Failed++
+				errs = append(errs, err)
+			}
+			progress.Elapsed = time.Since(start)
+			reporter.Progress(progress)
+		case <-done:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	progress.Elapsed = time.Since(start)
+	reporter.Finish(progress, ctx.Err() != nil)
+	return progress, errs
+}
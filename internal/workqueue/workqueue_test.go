@@ -0,0 +1,121 @@
+package workqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunDispatchesDynamically(t *testing.T) {
+	// job 0 only finishes once all other jobs are done, which only works if the other worker takes all of them
+	othersDone := make(chan struct{})
+	var finished atomic.Int32
+	progress, errs := Run(context.Background(), 10, Options{Workers: 2}, func(ctx context.Context, idx int) error {
+		if idx == 0 {
+			<-othersDone
+			return nil
+		}
+		if finished.Add(1) == 9 {
+			close(othersDone)
+		}
+		return nil
+	})
+
+	if len(errs) != 0 {
+		t.Errorf("Expected no errors. Got %v", errs)
+	}
+	if progress.Done != 10 || progress.Failed != 0 {
+		t.Errorf("Expected 10 done jobs. Got %+v", progress)
+	}
+}
+
+func TestRunCollectsErrors(t *testing.T) {
+	progress, errs := Run(context.Background(), 6, Options{Workers: 3}, func(ctx context.Context, idx int) error {
+		if idx%2 == 1 {
+			return fmt.Errorf("job %d failed", idx)
+		}
+		return nil
+	})
+
+	if len(errs) != 3 || progress.Failed != 3 || progress.Done != 6 {
+		t.Errorf("Expected 3 of 6 jobs to fail. Got %+v with errors %v", progress, errs)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var started atomic.Int32
+	progress, errs := Run(ctx, 100, Options{Workers: 1}, func(ctx context.Context, idx int) error {
+		started.Add(1)
+		if idx == 2 {
+			cancel()
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	if started.Load() != 3 {
+		t.Errorf("Expected no jobs to start after the cancellation. %d started", started.Load())
+	}
+	if len(errs) != 0 {
+		t.Errorf("Expected the cancelled job not to count as an error. Got %v", errs)
+	}
+	if progress.Done != 2 {
+		t.Errorf("Expected 2 done jobs. Got %+v", progress)
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	var out bytes.Buffer
+	Run(context.Background(), 3, Options{Label: "Testing", Reporter: JSON(&out)}, func(ctx context.Context, idx int) error {
+		return nil
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected start, 3 progress and finish events. Got %v", lines)
+	}
+	var last jsonEvent
+	if err := json.Unmarshal([]byte(lines[4]), &last); err != nil {
+		t.Fatalf("Can't parse event: %v", err)
+	}
+	if last.Event != "finish" || last.Label != "Testing" || last.Done != 3 || last.Total != 3 {
+		t.Errorf("Expected finish event with all jobs done. Got %+v", last)
+	}
+}
+
+func TestLinesReporter(t *testing.T) {
+	var out bytes.Buffer
+	Run(context.Background(), 200, Options{Label: "Testing", Reporter: Lines(&out)}, func(ctx context.Context, idx int) error {
+		return nil
+	})
+
+	// start, one line per percent and the final line
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 102 {
+		t.Errorf("Expected 102 lines. Got %d", len(lines))
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "Testing: finished; 100.00% done; 200 of 200") {
+		t.Errorf("Unexpected last line '%s'", lines[len(lines)-1])
+	}
+}
+
+func TestNewReporter(t *testing.T) {
+	var out bytes.Buffer
+	reporter, err := NewReporter(REPORTER_AUTO, &out)
+	if err != nil {
+		t.Fatalf("Expected no error. Got %v", err)
+	}
+	if _, ok := reporter.(*linesReporter); !ok {
+		t.Errorf("Expected log lines for a writer that isn't a terminal. Got %T", reporter)
+	}
+	if _, err := NewReporter("fancy", &out); err == nil {
+		t.Errorf("Expected error for unknown reporter")
+	}
+}